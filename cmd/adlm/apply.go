@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Apply local policy files without the lambda function
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	bucket := fs.String("bucket", "", "Bucket to load the guardrails and rules from")
+	guardrails := fs.String("guardrails", "", "Guardrails file, used instead of the bucket's")
+	rules := fs.String("rules", "", "Custom rules file, used instead of the bucket's")
+	prefix := fs.String("prefix", "", "Prefix the policy files are registered under (required)")
+	autoApprove := fs.Bool("auto-approve", false, "Skip the interactive confirmation")
+	fs.Parse(args)
+
+	// Records under the prefix without a file are deleted,
+	// so it must be given
+	if fs.NArg() != 1 || *prefix == "" {
+		return fmt.Errorf("Usage: adlm apply -prefix p [-bucket b] [-guardrails f] [-rules f] [--auto-approve] <directory>")
+	}
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	if err = loadChecks(p.Config(), *guardrails, *rules); err != nil {
+		return err
+	}
+
+	if *bucket == "" && (*guardrails == "" || *rules == "") {
+		fmt.Fprintln(os.Stderr, "Policies aren't checked against guardrails or rules that are neither given nor in a bucket")
+	}
+
+	sources, err := policy.LoadLocalSources(fs.Arg(0), *prefix)
+	if err != nil {
+		return err
+	}
+
+	changes, err := p.Plan(sources, *prefix)
+	if err != nil {
+		return err
+	}
+
+	policy.WritePlan(os.Stdout, changes)
+
+	pending := 0
+	for _, c := range changes {
+		if c.Action != policy.ActionNoOp {
+			pending++
+		}
+	}
+
+	if pending == 0 {
+		return nil
+	}
+
+	if !*autoApprove && !confirm(os.Stdin, os.Stdout) {
+		return fmt.Errorf("Apply cancelled")
+	}
+
+	return p.Apply(changes, *bucket, lambdacontext.LambdaContext{
+		AwsRequestID: fmt.Sprintf("adlm-apply-%d", time.Now().Unix()),
+	})
+}
+
+// Load the guardrails and rules files given
+func loadChecks(c *policy.Config, guardrails, rules string) error {
+	if guardrails != "" {
+		raw, err := ioutil.ReadFile(guardrails)
+		if err != nil {
+			return err
+		}
+
+		if c.Guardrails, err = policy.ParseGuardrails(raw); err != nil {
+			return err
+		}
+	}
+
+	if rules != "" {
+		raw, err := ioutil.ReadFile(rules)
+		if err != nil {
+			return err
+		}
+
+		if c.Rules, err = policy.ParseRules(raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ask for confirmation, only "yes" is accepted
+func confirm(r io.Reader, w io.Writer) bool {
+	fmt.Fprint(w, "\nDo you want to apply these changes? Only 'yes' will be accepted: ")
+
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+
+	return strings.TrimSpace(answer) == "yes"
+}
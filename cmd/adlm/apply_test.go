@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+func TestConfirm(t *testing.T) {
+	var b bytes.Buffer
+
+	assert.True(t, confirm(strings.NewReader("yes\n"), &b))
+	assert.Contains(t, b.String(), "Only 'yes' will be accepted")
+
+	assert.False(t, confirm(strings.NewReader("y\n"), &b))
+	assert.False(t, confirm(strings.NewReader(""), &b))
+}
+
+func TestApplyRequiresFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"./policies"},
+		{"-bucket", "b", "./policies"},
+		{"-prefix", "policies/"},
+	} {
+		err := runApply(args)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Usage: adlm apply")
+	}
+}
+
+func TestLoadChecks(t *testing.T) {
+	c := policy.DefaultConfig()
+	assert.NoError(t, loadChecks(c, "", ""))
+	assert.Nil(t, c.Guardrails)
+	assert.Nil(t, c.Rules)
+
+	dir, err := ioutil.TempDir("", "adlm-apply")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	guardrails := filepath.Join(dir, "_guardrails.yaml")
+	rules := filepath.Join(dir, "_rules.yaml")
+	assert.NoError(t, ioutil.WriteFile(guardrails, []byte("MinRetention: 7\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(rules, []byte("Rules:\n- Name: daily\n  Expression: policy.State == \"ENABLED\"\n"), 0644))
+
+	assert.NoError(t, loadChecks(c, guardrails, rules))
+	assert.Equal(t, int64(7), c.Guardrails.MinRetention)
+	assert.Len(t, c.Rules.Rules, 1)
+
+	assert.Error(t, loadChecks(c, filepath.Join(dir, "missing.yaml"), ""))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dlm"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sns"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Policy facade using the credentials and region
+// of the environment or the shared AWS config,
+// the same way the AWS CLI does.
+func newPolicy() (*policy.Policy, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := policy.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(policy.Policy)
+	p.SetClients(&policy.AwsClients{
+		S3:           s3.New(sess),
+		S3Downloader: s3manager.NewDownloader(sess),
+		S3Uploader:   s3manager.NewUploader(sess),
+		Dynamodb:     dynamodb.New(sess),
+		Dlm:          dlm.New(sess),
+		Iam:          iam.New(sess),
+		Sns:          sns.New(sess),
+	})
+	p.SetConfig(config)
+
+	return p, nil
+}
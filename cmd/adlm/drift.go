@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Report policies that drifted from their files
+func runDrift(args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	bucket := fs.String("bucket", "", "Bucket of the policy files")
+	reapply := fs.Bool("reapply", false, "Apply the files of the drifted policies again")
+	format := fs.String("o", formatText, "Output format: text or json")
+	fs.Parse(args)
+
+	if *bucket == "" || fs.NArg() > 0 {
+		return fmt.Errorf("Usage: adlm drift -bucket b [-reapply] [-o text|json]")
+	}
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	d := policy.NewDriftDetector(p, *bucket)
+	drifts, err := d.Detect()
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case formatText:
+		for _, drift := range drifts {
+			fmt.Println(drift)
+			policy.WriteDiffs(os.Stdout, drift.Diffs, "    ")
+		}
+
+		fmt.Printf("%d policy(ies) drifted\n", len(drifts))
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if drifts == nil {
+			drifts = []*policy.Drift{}
+		}
+
+		if err := enc.Encode(drifts); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown output format %q", *format)
+	}
+
+	if !*reapply {
+		return nil
+	}
+
+	config, err := policy.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	config.DriftAction = policy.DriftReapply
+	p.SetConfig(config)
+
+	return d.Respond(drifts, lambdacontext.LambdaContext{
+		AwsRequestID: fmt.Sprintf("adlm-drift-%d", time.Now().Unix()),
+	})
+}
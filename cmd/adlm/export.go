@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Export the live state of managed policies
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	bucket := fs.String("bucket", "", "Upload the policy files to this bucket")
+	dir := fs.String("dir", "", "Write the policy files to this directory")
+	prefix := fs.String("prefix", "", "Prefix to write the policy files under")
+	fs.Parse(args)
+
+	if (*bucket == "") == (*dir == "") || fs.NArg() > 0 {
+		return fmt.Errorf("Usage: adlm export (-bucket b | -dir d) [-prefix p]")
+	}
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	// Files written to the policy bucket would be applied
+	// by the function as new policies
+	if p.Config().IsPolicyBucket(*bucket) {
+		return fmt.Errorf("Refusing to export to the policy bucket %s. Use another bucket or -dir", *bucket)
+	}
+
+	var w policy.Writer = policy.DirWriter{Dir: *dir, Prefix: *prefix}
+	if *bucket != "" {
+		w = policy.BucketWriter{Bucket: *bucket, Uploader: p.Clients().S3Uploader}
+	}
+
+	exported, err := p.Export(w, *prefix)
+
+	missing := 0
+	for _, e := range exported {
+		if e.Missing {
+			missing++
+			fmt.Printf("Missing %s, policy %s doesn't exist\n", e.Key, e.PolicyId)
+			continue
+		}
+
+		fmt.Printf("Exported %s as %s\n", e.PolicyId, e.Key)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d policy(ies) exported, %d missing\n", len(exported)-missing, missing)
+
+	return nil
+}
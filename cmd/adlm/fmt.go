@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Format policy files into the canonical format
+func runFmt(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "Write the result back to the files instead of stdout")
+	check := fs.Bool("check", false, "Only list the files that are not formatted and fail if there is any")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("Usage: adlm fmt [-w] [-check] <file or directory>...")
+	}
+
+	files, err := file.Find(fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	unformatted := 0
+	for _, f := range files {
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+
+		out, err := file.Format(src)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+
+		switch {
+		case *check:
+			if !bytes.Equal(src, out) {
+				fmt.Println(f)
+				unformatted++
+			}
+		case *write:
+			if !bytes.Equal(src, out) {
+				if err := ioutil.WriteFile(f, out, 0644); err != nil {
+					return err
+				}
+			}
+		default:
+			os.Stdout.Write(out)
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d file(s) not formatted. Run `adlm fmt -w` to fix them", unformatted)
+	}
+
+	return nil
+}
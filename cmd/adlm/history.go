@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// List, diff and roll back the versions of a policy file
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	bucket := fs.String("bucket", "", "Bucket of the policy file")
+	diff := fs.String("diff", "", "Compare two versions, FROM..TO. TO defaults to the latest version")
+	rollback := fs.String("rollback", "", "Apply this version to DLM")
+	autoApprove := fs.Bool("auto-approve", false, "Skip the interactive confirmation of the rollback")
+	fs.Parse(args)
+
+	if *bucket == "" || fs.NArg() != 1 || (*diff != "" && *rollback != "") {
+		return fmt.Errorf("Usage: adlm history -bucket b [-diff FROM[..TO] | -rollback VERSION [--auto-approve]] <key>")
+	}
+
+	key := fs.Arg(0)
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *diff != "":
+		parts := strings.SplitN(*diff, "..", 2)
+		to := ""
+		if len(parts) == 2 {
+			to = parts[1]
+		}
+
+		diffs, err := p.DiffVersions(*bucket, key, parts[0], to)
+		if err != nil {
+			return err
+		}
+
+		if len(diffs) == 0 {
+			fmt.Println("No differences.")
+			return nil
+		}
+
+		policy.WriteDiffs(os.Stdout, diffs, "")
+	case *rollback != "":
+		diffs, err := p.DiffVersions(*bucket, key, "", *rollback)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Rolling back %s to version %s changes:\n", key, *rollback)
+		policy.WriteDiffs(os.Stdout, diffs, "    ")
+
+		if !*autoApprove && !confirm(os.Stdin, os.Stdout) {
+			return fmt.Errorf("Rollback cancelled")
+		}
+
+		err = p.Rollback(*bucket, key, *rollback, lambdacontext.LambdaContext{
+			AwsRequestID: fmt.Sprintf("adlm-rollback-%d", time.Now().Unix()),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Rolled back %s to version %s\n", key, *rollback)
+	default:
+		versions, err := policy.ListVersions(*bucket, key, p.Clients().S3)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION ID\tLAST MODIFIED\tSIZE\t")
+		for _, v := range versions {
+			var notes []string
+			if v.IsLatest {
+				notes = append(notes, "latest")
+			}
+			if v.DeleteMarker {
+				notes = append(notes, "deleted")
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", v.VersionId, v.LastModified.UTC().Format(time.RFC3339), v.Size, strings.Join(notes, ", "))
+		}
+
+		return tw.Flush()
+	}
+
+	return nil
+}
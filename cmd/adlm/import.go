@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Import existing DLM policies
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	bucket := fs.String("bucket", "", "Upload the policy files to this bucket")
+	dir := fs.String("dir", "", "Write the policy files to this directory")
+	prefix := fs.String("prefix", "", "Prefix the policy files are registered under")
+	fs.Parse(args)
+
+	if (*bucket == "") == (*dir == "") {
+		return fmt.Errorf("Usage: adlm import (-bucket b | -dir d) [-prefix p] [policy id]...")
+	}
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	var w policy.Writer = policy.DirWriter{Dir: *dir, Prefix: *prefix}
+	if *bucket != "" {
+		w = policy.BucketWriter{Bucket: *bucket, Uploader: p.Clients().S3Uploader}
+	}
+
+	imported, err := p.Import(w, *prefix, fs.Args(), lambdacontext.LambdaContext{
+		AwsRequestID: fmt.Sprintf("adlm-import-%d", time.Now().Unix()),
+	})
+
+	for _, i := range imported {
+		fmt.Printf("Imported %s as %s\n", i.PolicyId, i.Key)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d policy(ies) imported\n", len(imported))
+
+	return nil
+}
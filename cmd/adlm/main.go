@@ -0,0 +1,108 @@
+// Command adlm is the command line companion of the
+// adlm-helper lambda function. It works with the same
+// policy files that are uploaded to the S3 bucket.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Sub command
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+// Available sub commands
+var commands = map[string]command{
+	"apply": {
+		summary: "Apply policy files to DLM without the lambda function",
+		run:     runApply,
+	},
+	"drift": {
+		summary: "Report managed policies that were changed outside their files",
+		run:     runDrift,
+	},
+	"export": {
+		summary: "Write the live state of managed policies as policy files",
+		run:     runExport,
+	},
+	"fmt": {
+		summary: "Rewrite policy files into the canonical format",
+		run:     runFmt,
+	},
+	"history": {
+		summary: "List, diff and roll back the versions of a policy file",
+		run:     runHistory,
+	},
+	"import": {
+		summary: "Bring existing DLM policies under management",
+		run:     runImport,
+	},
+	"orphans": {
+		summary: "Adopt or delete DLM policies of adlm-helper without a record",
+		run:     runOrphans,
+	},
+	"plan": {
+		summary: "Show what uploading policy files would change in DLM",
+		run:     runPlan,
+	},
+	"render": {
+		summary: "Print the DLM API input of a policy file",
+		run:     runRender,
+	},
+	"replay": {
+		summary: "Replay S3 event records, e.g. of a failed invocation",
+		run:     runReplay,
+	},
+	"schema": {
+		summary: "Print the JSON Schema of the policy file",
+		run:     runSchema,
+	},
+	"status": {
+		summary: "List the managed policies with their live state",
+		run:     runStatus,
+	},
+	"validate": {
+		summary: "Validate policy files",
+		run:     runValidate,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Print the list of sub commands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: adlm <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// List orphaned DLM policies and sweep them
+func runOrphans(args []string) error {
+	fs := flag.NewFlagSet("orphans", flag.ExitOnError)
+	bucket := fs.String("bucket", "", "Bucket of the policy files")
+	sweep := fs.Bool("sweep", false, "Adopt or delete the listed orphans")
+	autoApprove := fs.Bool("auto-approve", false, "Skip the interactive confirmation")
+	format := fs.String("o", formatText, "Output format: text or json")
+	fs.Parse(args)
+
+	if *bucket == "" || fs.NArg() > 0 {
+		return fmt.Errorf("Usage: adlm orphans -bucket b [-sweep] [--auto-approve] [-o text|json]")
+	}
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	c := p.Clients()
+	sources, err := policy.LoadBucketSources(*bucket, "", c.S3, c.S3Downloader)
+	if err != nil {
+		return err
+	}
+
+	orphans, err := p.FindOrphans(sources)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case formatText:
+		for _, o := range orphans {
+			fmt.Printf("%s %s matched by %s: %s (%s)\n", o.PolicyId, o.Key, o.Match, o.Action, o.Reason)
+		}
+
+		fmt.Printf("%d orphan(s) found\n", len(orphans))
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if orphans == nil {
+			orphans = []*policy.Orphan{}
+		}
+
+		if err := enc.Encode(orphans); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown output format %q", *format)
+	}
+
+	if !*sweep || len(orphans) == 0 {
+		return nil
+	}
+
+	if !*autoApprove && !confirm(os.Stdin, os.Stdout) {
+		return fmt.Errorf("Sweep cancelled")
+	}
+
+	return p.Sweep(orphans, lambdacontext.LambdaContext{
+		AwsRequestID: fmt.Sprintf("adlm-orphans-%d", time.Now().Unix()),
+	})
+}
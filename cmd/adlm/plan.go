@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Show what uploading the policy files would change
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	bucket := fs.String("bucket", "", "Plan the objects of this bucket instead of a local directory")
+	prefix := fs.String("prefix", "", "Bucket prefix the policy files are uploaded to")
+	format := fs.String("o", formatText, "Output format: text or json")
+	fs.Parse(args)
+
+	if (*bucket == "") == (fs.NArg() == 0) || fs.NArg() > 1 {
+		return fmt.Errorf("Usage: adlm plan [-prefix p] [-o text|json] <directory> | -bucket b [-prefix p]")
+	}
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	changes, err := planChanges(p, *bucket, *prefix, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case formatText:
+		policy.WritePlan(os.Stdout, changes)
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if changes == nil {
+			changes = []*policy.Change{}
+		}
+
+		return enc.Encode(changes)
+	default:
+		return fmt.Errorf("Unknown output format %q", *format)
+	}
+
+	return nil
+}
+
+// Plan the policy files of a local directory or a bucket prefix
+func planChanges(p *policy.Policy, bucket, prefix, dir string) ([]*policy.Change, error) {
+	if bucket != "" {
+		return p.PlanBucket(bucket, prefix)
+	}
+
+	sources, err := policy.LoadLocalSources(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Plan(sources, prefix)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Print the DLM input of a policy file
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	policyId := fs.String("update", "", "Render the update input of this policy id instead of the create input")
+	bucket := fs.String("bucket", "", "Bucket the file is uploaded to")
+	key := fs.String("key", "", "Key the file is uploaded as, the file name by default")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: adlm render [-update policy id] [-bucket b] [-key k] <file>")
+	}
+
+	if *key == "" {
+		*key = filepath.Base(fs.Arg(0))
+	}
+
+	raw, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	f, err := file.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+
+	out, err := render(f, *policyId, *bucket, *key)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(os.Stdout, "%s\n", out)
+	return err
+}
+
+// Create input of the object, or update input if the
+// policy id is given
+func render(f *file.Policy, policyId, bucket, key string) ([]byte, error) {
+	if policyId == "" {
+		return policy.Render(f, bucket, key)
+	}
+
+	input, err := policy.NewUpdateInput(f, policyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy.RenderInput(input)
+}
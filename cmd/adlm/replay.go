@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/local"
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// Replay S3 event records through the processors
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	dir := fs.String("local", "", "Run against local fakes, serving the objects from this directory")
+	registry := fs.String("registry", "", "JSON list of registry records to start the local fakes with")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || (*registry != "" && *dir == "") {
+		return fmt.Errorf("Usage: adlm replay [-local dir [-registry records.json]] <event file or - for stdin>")
+	}
+
+	raw, err := readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	records, err := policy.ParseRecords(raw)
+	if err != nil {
+		return err
+	}
+
+	var p *policy.Policy
+	if *dir != "" {
+		p, err = newLocalPolicy(*dir, *registry)
+	} else {
+		p, err = newPolicy()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	results := p.HandleRecords(records, lambdacontext.LambdaContext{
+		AwsRequestID: fmt.Sprintf("adlm-replay-%d", time.Now().Unix()),
+	})
+
+	failed := writeResults(os.Stdout, results)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d record(s) failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// Policy facade running against local fakes.
+// Execution roles aren't verified.
+func newLocalPolicy(dir, registry string) (*policy.Policy, error) {
+	var items []*db.Item
+	if registry != "" {
+		raw, err := ioutil.ReadFile(registry)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("Failed to parse registry %s: %v", registry, err)
+		}
+	}
+
+	var ids []string
+	for _, i := range items {
+		ids = append(ids, i.PolicyId)
+	}
+
+	config, err := policy.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(policy.Policy)
+	p.SetClients(&policy.AwsClients{
+		S3Downloader: local.Downloader{Dir: dir},
+		Dlm:          local.NewDlm(ids...),
+	})
+	p.SetDBConn(db.NewMemory(items...))
+	p.SetConfig(config)
+
+	return p, nil
+}
+
+// Read a file or stdin
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(name)
+}
+
+// Print one line per record, returns the number of failures
+func writeResults(w io.Writer, results []*policy.RecordResult) int {
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.Skipped != "":
+			fmt.Fprintf(w, "skipped  %s (%s): %s\n", r.Key, r.EventName, r.Skipped)
+		case r.Ok():
+			fmt.Fprintf(w, "ok       %s (%s)\n", r.Key, r.EventName)
+		default:
+			failed++
+			fmt.Fprintf(w, "failed   %s (%s): %v\n", r.Key, r.EventName, r.Err)
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+func TestWriteResults(t *testing.T) {
+	var b bytes.Buffer
+	failed := writeResults(&b, []*policy.RecordResult{
+		{Key: "a.yaml", EventName: "ObjectCreated:Put"},
+		{Key: "_rules.yaml", EventName: "ObjectCreated:Put", Skipped: "reserved object"},
+		{Key: "b.yaml", EventName: "ObjectRemoved:Delete", Err: errors.New("denied")},
+	})
+
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, "ok       a.yaml (ObjectCreated:Put)\n"+
+		"skipped  _rules.yaml (ObjectCreated:Put): reserved object\n"+
+		"failed   b.yaml (ObjectRemoved:Delete): denied\n", b.String())
+}
+
+func TestReplayLocal(t *testing.T) {
+	raw, err := readInput("../../testdata/s3_event.json")
+	assert.NoError(t, err)
+
+	records, err := policy.ParseRecords(raw)
+	assert.NoError(t, err)
+
+	p, err := newLocalPolicy("../../testdata", "")
+	assert.NoError(t, err)
+
+	var b bytes.Buffer
+	assert.Equal(t, 0, writeResults(&b, p.HandleRecords(records, lambdacontext.LambdaContext{})))
+	assert.Contains(t, b.String(), "ok       policy_example.yaml")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Print or write the policy JSON Schema
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	output := fs.String("o", "", "Write the schema to the given file instead of stdout")
+	fs.Parse(args)
+
+	s, err := file.Schema()
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		return ioutil.WriteFile(*output, s, 0644)
+	}
+
+	_, err = os.Stdout.Write(s)
+	return err
+}
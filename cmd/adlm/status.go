@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/liangrog/adlm-helper/dlm/policy"
+)
+
+// List the managed policies with their live state
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	format := fs.String("o", formatText, "Output format: text or json")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("Usage: adlm status [-o text|json]")
+	}
+
+	p, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := p.Status()
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case formatText:
+		return policy.WriteStatus(os.Stdout, statuses)
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if statuses == nil {
+			statuses = []*policy.PolicyStatus{}
+		}
+
+		return enc.Encode(statuses)
+	}
+
+	return fmt.Errorf("Unknown output format %q", *format)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Output formats
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatJUnit = "junit"
+)
+
+// Validation result of a file
+type fileResult struct {
+	File     string         `json:"file"`
+	Valid    bool           `json:"valid"`
+	Problems []file.Problem `json:"problems,omitempty"`
+}
+
+// Validate policy files, e.g. in CI
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	format := fs.String("o", formatText, "Output format: text, json or junit")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("Usage: adlm validate [-o text|json|junit] <file or directory>...")
+	}
+
+	files, err := file.Find(fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	results, err := validateFiles(files)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case formatText:
+		writeText(os.Stdout, results)
+	case formatJSON:
+		err = writeJSON(os.Stdout, results)
+	case formatJUnit:
+		err = writeJUnit(os.Stdout, results)
+	default:
+		return fmt.Errorf("Unknown output format %q", *format)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	invalid := 0
+	for _, r := range results {
+		if !r.Valid {
+			invalid++
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d file(s) invalid", invalid, len(results))
+	}
+
+	return nil
+}
+
+// Validate every file
+func validateFiles(files []string) ([]fileResult, error) {
+	var results []fileResult
+	for _, f := range files {
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		_, problems := file.Validate(src)
+		results = append(results, fileResult{
+			File:     f,
+			Valid:    len(problems) == 0,
+			Problems: problems,
+		})
+	}
+
+	return results, nil
+}
+
+// Problems grouped by file
+func writeText(w io.Writer, results []fileResult) {
+	invalid := 0
+	for _, r := range results {
+		if r.Valid {
+			continue
+		}
+
+		invalid++
+		fmt.Fprintln(w, r.File)
+		for _, p := range r.Problems {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+	}
+
+	fmt.Fprintf(w, "%d file(s) checked, %d invalid\n", len(results), invalid)
+}
+
+func writeJSON(w io.Writer, results []fileResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if results == nil {
+		results = []fileResult{}
+	}
+
+	return enc.Encode(results)
+}
+
+// JUnit report, one test case per file
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, results []fileResult) error {
+	suite := junitSuite{
+		Name:  "adlm validate",
+		Tests: len(results),
+	}
+
+	for _, r := range results {
+		c := junitCase{
+			Name:      r.File,
+			ClassName: "adlm.validate",
+		}
+
+		if !r.Valid {
+			suite.Failures++
+
+			var lines []string
+			for _, p := range r.Problems {
+				lines = append(lines, p.String())
+			}
+
+			c.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d problem(s)", len(r.Problems)),
+				Text:    strings.Join(lines, "\n"),
+			}
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+var results = []fileResult{
+	{File: "ok.yaml", Valid: true},
+	{
+		File: "bad.yaml",
+		Problems: []file.Problem{
+			{Line: 3, Field: "State", Message: "must be one of ENABLED, DISABLED, got \"PAUSED\""},
+		},
+	},
+}
+
+func TestValidateFiles(t *testing.T) {
+	files, err := file.Find("../../examples", "../../testdata")
+	assert.NoError(t, err)
+
+	rs, err := validateFiles(files)
+	assert.NoError(t, err)
+	assert.Len(t, rs, 2)
+	for _, r := range rs {
+		assert.True(t, r.Valid, r.File)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var b bytes.Buffer
+	writeText(&b, results)
+
+	assert.Equal(t, "bad.yaml\n  line 3: State: must be one of ENABLED, DISABLED, got \"PAUSED\"\n2 file(s) checked, 1 invalid\n", b.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, writeJSON(&b, results))
+
+	var decoded []fileResult
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &decoded))
+	assert.Equal(t, results, decoded)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, writeJUnit(&b, results))
+
+	suite := new(junitSuite)
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), suite))
+	assert.Equal(t, 2, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Nil(t, suite.Cases[0].Failure)
+	assert.Contains(t, suite.Cases[1].Failure.Text, "line 3: State")
+}
@@ -1,12 +1,52 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
+// Returned when a write carries an older S3 event
+// sequencer than the one the record was written with.
+// Writes of the same event are let through, so an
+// event claimed but not applied can be retried.
+var ErrOutOfOrder = errors.New("Event is older than the last one applied to the record")
+
+// Returned when a record was changed by someone else
+// since it was read. Reload the record and try again.
+type ConflictError struct {
+	Key     string
+	Version int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Record of %s was changed concurrently, it's no longer at version %d", e.Key, e.Version)
+}
+
+// If the error is a write conflict
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// State of a record whose policy is being created
+const StatePending = "PENDING"
+
+// Origin of records written by adlm apply or import
+// rather than by events of the bucket
+const OriginLocal = "LOCAL"
+
+// Length sequencers are padded to, so they can be
+// compared as strings
+const sequencerLen = 32
+
 // Database abstract
 type DB interface {
 	FindByKey(string) (*Item, error)
+	All() ([]*Item, error)
+	Pending() ([]*Item, error)
 	Create(*Item) error
 	Update(*Item) error
 	Delete(*Item) error
@@ -19,11 +59,71 @@ type Item struct {
 	RequestId   string `json:"requestid"`
 	CreatedAt   string `json:"createdat"`
 	UpdatedAt   string `json:"updatedat"`
+
+	// S3 version the policy was rolled back to, if any
+	RollbackVersion string `json:"rollbackversion,omitempty"`
+
+	// S3 version of the file last applied, if known
+	ObjectVersion string `json:"objectversion,omitempty"`
+
+	// Hash of the DLM input last applied
+	Hash string `json:"hash,omitempty"`
+
+	// S3 event last applied, see PadSequencer
+	Sequencer string `json:"sequencer,omitempty"`
+	EventTime string `json:"eventtime,omitempty"`
+
+	// Where the record was written from, empty for the
+	// bucket, see OriginLocal
+	Origin string `json:"origin,omitempty"`
+
+	// Tombstone of a deleted file
+	Deleted bool `json:"deleted,omitempty"`
+
+	// Create in progress. The client token tags the
+	// policy being created, the time is RFC3339.
+	State        string `json:"state,omitempty"`
+	ClientToken  string `json:"clienttoken,omitempty"`
+	PendingSince string `json:"pendingsince,omitempty"`
+
+	// Incremented by every write. Writes are conditioned
+	// on the version the record was read at.
+	Version int64 `json:"version,omitempty"`
+}
+
+// If the record's policy is being created
+func (i *Item) IsPending() bool {
+	return i.State == StatePending
+}
+
+// If the record was written from a policy file. Records
+// registered for a file that isn't uploaded yet, e.g. by
+// an import into a directory, aren't.
+func (i *Item) HasSource() bool {
+	return i.Hash != "" || i.Sequencer != "" || i.ObjectVersion != ""
+}
+
+// If the record was written by adlm apply or import
+func (i *Item) IsLocal() bool {
+	return i.Origin == OriginLocal
+}
+
+// PadSequencer right pads an S3 event sequencer with
+// zeros. Sequencers of the same key are compared as
+// strings once the shorter one is padded, as S3 says.
+func PadSequencer(s string) string {
+	if s == "" || len(s) >= sequencerLen {
+		return s
+	}
+
+	return s + strings.Repeat("0", sequencerLen-len(s))
 }
 
 // Database factory
 func GetConn(i interface{}) DB {
 	switch v := i.(type) {
+	case DB:
+		return v
 	case dynamodbiface.DynamoDBAPI:
 		return &Dynamo{
 			client: v,
@@ -1,7 +1,11 @@
 package db
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
@@ -12,6 +16,9 @@ var (
 	tableName = "adlm-helper"
 )
 
+// Condition keeping older events from writing a record
+const notOlderEvent = "attribute_not_exists(#SQ) OR #SQ <= :s"
+
 // Table primary key
 type ItemKey struct {
 	S3ObjectKey string `json:"s3objectkey"`
@@ -19,8 +26,19 @@ type ItemKey struct {
 
 // fields needed for update
 type ItemUpdate struct {
-	RequestId string `json:":r"`
-	UpdatedAt string `json:":u"`
+	PolicyId        string `json:":p"`
+	RequestId       string `json:":r"`
+	UpdatedAt       string `json:":u"`
+	Hash            string `json:":h"`
+	RollbackVersion string `json:":v,omitempty"`
+	ObjectVersion   string `json:":o,omitempty"`
+	Sequencer       string `json:":s,omitempty"`
+	EventTime       string `json:":e,omitempty"`
+	State           string `json:":t,omitempty"`
+	ClientToken     string `json:":c,omitempty"`
+	PendingSince    string `json:":ps,omitempty"`
+	Origin          string `json:":og,omitempty"`
+	NextVersion     int64  `json:":vn"`
 }
 
 type Dynamo struct {
@@ -56,28 +74,100 @@ func (d *Dynamo) FindByKey(k string) (*Item, error) {
 	return nil, nil
 }
 
-// Create a record
+// List all records except tombstones and pending ones
+func (d *Dynamo) All() ([]*Item, error) {
+	return d.scan(&dynamodb.ScanInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#ST": aws.String("state"),
+		},
+		FilterExpression: aws.String("attribute_not_exists(deleted) AND attribute_not_exists(#ST)"),
+		TableName:        aws.String(tableName),
+	})
+}
+
+// List the pending records
+func (d *Dynamo) Pending() ([]*Item, error) {
+	return d.scan(&dynamodb.ScanInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#ST": aws.String("state"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": {S: aws.String(StatePending)},
+		},
+		FilterExpression: aws.String("#ST = :t"),
+		TableName:        aws.String(tableName),
+	})
+}
+
+// Scan every page of the table
+func (d *Dynamo) scan(input *dynamodb.ScanInput) ([]*Item, error) {
+	var items []*Item
+
+	for {
+		result, err := d.client.Scan(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []*Item
+		if err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, err
+		}
+
+		items = append(items, page...)
+
+		// Continue from where the last page stopped
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return items, nil
+}
+
+// Create a record, unless there is one other than a
+// tombstone. With a sequencer, unless it's older than
+// the record's. The item gets the first version.
 func (d *Dynamo) Create(i *Item) error {
-	item, err := dynamodbattribute.MarshalMap(i)
+	c := *i
+	c.Version = 1
+
+	item, err := dynamodbattribute.MarshalMap(c)
 
 	if err != nil {
 		return err
 	}
 
+	names := map[string]*string{
+		"#DL": aws.String("deleted"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":true": {BOOL: aws.Bool(true)},
+	}
+
 	input := &dynamodb.PutItemInput{
-		Item:      item,
-		TableName: aws.String(tableName),
+		ConditionExpression:       aws.String(notOlderThan(i, "(attribute_not_exists(s3objectkey) OR #DL = :true)", names, values)),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		Item:                      item,
+		TableName:                 aws.String(tableName),
 	}
 
 	_, err = d.client.PutItem(input)
 	if err != nil {
-		return err
+		return d.conditionErr(err, i)
 	}
 
+	i.Version = c.Version
+
 	return nil
 }
 
-// Update a record
+// Update a record if it's still at the item's version.
+// With a sequencer, unless it's older than the record's.
+// The item gets the next version.
 func (d *Dynamo) Update(i *Item) error {
 	key, err := dynamodbattribute.MarshalMap(ItemKey{
 		S3ObjectKey: i.S3ObjectKey,
@@ -88,52 +178,216 @@ func (d *Dynamo) Update(i *Item) error {
 	}
 
 	update, err := dynamodbattribute.MarshalMap(ItemUpdate{
-		RequestId: i.RequestId,
-		UpdatedAt: i.UpdatedAt,
+		PolicyId:        i.PolicyId,
+		RequestId:       i.RequestId,
+		UpdatedAt:       i.UpdatedAt,
+		Hash:            i.Hash,
+		RollbackVersion: i.RollbackVersion,
+		ObjectVersion:   i.ObjectVersion,
+		Sequencer:       i.Sequencer,
+		EventTime:       i.EventTime,
+		State:           i.State,
+		ClientToken:     i.ClientToken,
+		PendingSince:    i.PendingSince,
+		Origin:          i.Origin,
+		NextVersion:     i.Version + 1,
 	})
 
 	if err != nil {
 		return err
 	}
 
+	// Policy id changes when the policy is recreated.
+	// Rollback version only stays until the next update.
+	// Versions unknown to the update are removed.
+	set := []string{"#PI = :p", "#RI = :r", "#UA = :u", "#HA = :h", "#VE = :vn"}
+	var remove []string
+	names := map[string]*string{
+		"#PI": aws.String("policyid"),
+		"#RI": aws.String("requestid"),
+		"#UA": aws.String("updatedat"),
+		"#HA": aws.String("hash"),
+		"#RV": aws.String("rollbackversion"),
+		"#OV": aws.String("objectversion"),
+		"#ST": aws.String("state"),
+		"#CT": aws.String("clienttoken"),
+		"#PS": aws.String("pendingsince"),
+		"#OG": aws.String("origin"),
+	}
+
+	if i.RollbackVersion != "" {
+		set = append(set, "#RV = :v")
+	} else {
+		remove = append(remove, "#RV")
+	}
+
+	if i.ObjectVersion != "" {
+		set = append(set, "#OV = :o")
+	} else {
+		remove = append(remove, "#OV")
+	}
+
+	// Committing a create clears its pending state.
+	// Empty values can't be set, they are removed.
+	if i.State != "" {
+		set = append(set, "#ST = :t")
+	} else {
+		remove = append(remove, "#ST")
+	}
+
+	if i.ClientToken != "" {
+		set = append(set, "#CT = :c")
+	} else {
+		remove = append(remove, "#CT")
+	}
+
+	if i.PendingSince != "" {
+		set = append(set, "#PS = :ps")
+	} else {
+		remove = append(remove, "#PS")
+	}
+
+	// Records of the bucket have no origin
+	if i.Origin != "" {
+		set = append(set, "#OG = :og")
+	} else {
+		remove = append(remove, "#OG")
+	}
+
+	if i.Sequencer != "" {
+		set = append(set, "#SQ = :s")
+	}
+
+	if i.EventTime != "" {
+		set = append(set, "#ET = :e")
+		names["#ET"] = aws.String("eventtime")
+	}
+
+	expression := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		expression += " REMOVE " + strings.Join(remove, ", ")
+	}
+
 	input := &dynamodb.UpdateItemInput{
-		Key: key,
-		ExpressionAttributeNames: map[string]*string{
-			"#RI": aws.String("requestid"),
-			"#UA": aws.String("updatedat"),
-		},
+		ConditionExpression:       aws.String(notOlderThan(i, expectVersion(i.Version, names, update), names, update)),
+		Key:                       key,
+		ExpressionAttributeNames:  names,
 		ExpressionAttributeValues: update,
 		TableName:                 aws.String(tableName),
-		UpdateExpression:          aws.String("SET #RI = :r, #UA = :u"),
+		UpdateExpression:          aws.String(expression),
 	}
 
 	_, err = d.client.UpdateItem(input)
 	if err != nil {
-		return err
+		return d.conditionErr(err, i)
 	}
 
+	i.Version++
+
 	return nil
 }
 
-// Delete a record
+// Delete a record if it's still at the item's version.
+// With a sequencer, the record is replaced by a tombstone
+// so late events of the deleted file are still ordered.
 func (d *Dynamo) Delete(i *Item) error {
-	key, err := dynamodbattribute.MarshalMap(ItemKey{
-		S3ObjectKey: i.S3ObjectKey,
-	})
+	names := make(map[string]*string)
+	values := make(map[string]*dynamodb.AttributeValue)
+	condition := notOlderThan(i, expectVersion(i.Version, names, values), names, values)
+
+	var err error
+	if i.Sequencer != "" {
+		var item map[string]*dynamodb.AttributeValue
+		if item, err = dynamodbattribute.MarshalMap(tombstone(i)); err != nil {
+			return err
+		}
+
+		_, err = d.client.PutItem(&dynamodb.PutItemInput{
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			Item:                      item,
+			TableName:                 aws.String(tableName),
+		})
+	} else {
+		var key map[string]*dynamodb.AttributeValue
+		if key, err = dynamodbattribute.MarshalMap(ItemKey{S3ObjectKey: i.S3ObjectKey}); err != nil {
+			return err
+		}
+
+		input := &dynamodb.DeleteItemInput{
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			Key:                       key,
+			TableName:                 aws.String(tableName),
+		}
+
+		// Values can't be empty
+		if len(values) == 0 {
+			input.ExpressionAttributeValues = nil
+		}
+
+		_, err = d.client.DeleteItem(input)
+	}
 
 	if err != nil {
-		return err
+		return d.conditionErr(err, i)
+	}
+
+	return nil
+}
+
+// Tombstone of a record, at the next version
+func tombstone(i *Item) *Item {
+	return &Item{
+		S3ObjectKey: i.S3ObjectKey,
+		RequestId:   i.RequestId,
+		UpdatedAt:   i.UpdatedAt,
+		Sequencer:   i.Sequencer,
+		EventTime:   i.EventTime,
+		Deleted:     true,
+		Version:     i.Version + 1,
 	}
+}
 
-	input := &dynamodb.DeleteItemInput{
-		Key:       key,
-		TableName: aws.String(tableName),
+// Condition on the version of the record. Records
+// written before versioning have none, like new ones.
+func expectVersion(version int64, names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	names["#VE"] = aws.String("version")
+	if version == 0 {
+		return "attribute_not_exists(#VE)"
 	}
 
-	_, err = d.client.DeleteItem(input)
-	if err != nil {
+	values[":ve"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(version, 10))}
+
+	return "#VE = :ve"
+}
+
+// Add the event order to a condition if the item has
+// a sequencer
+func notOlderThan(i *Item, condition string, names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	if i.Sequencer == "" {
+		return condition
+	}
+
+	names["#SQ"] = aws.String("sequencer")
+	values[":s"] = &dynamodb.AttributeValue{S: aws.String(i.Sequencer)}
+
+	return condition + " AND (" + notOlderEvent + ")"
+}
+
+// Tell which condition of a write failed by reading the
+// record again. Either the event is out of order or the
+// record was changed since it was read.
+func (d *Dynamo) conditionErr(err error, i *Item) error {
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
 		return err
 	}
 
-	return nil
+	if cur, ferr := d.FindByKey(i.S3ObjectKey); ferr == nil && cur != nil && i.Sequencer != "" && cur.Sequencer > i.Sequencer {
+		return ErrOutOfOrder
+	}
+
+	return &ConflictError{Key: i.S3ObjectKey, Version: i.Version}
 }
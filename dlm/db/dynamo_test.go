@@ -52,6 +52,53 @@ func TestFindByKeyError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestAll(t *testing.T) {
+	dy := &Dynamo{
+		client: &test.MockDynamoDB{
+			Payload: map[string]string{
+				"scan": "yes",
+			},
+		},
+	}
+
+	items, err := dy.All()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "other.yaml", items[0].S3ObjectKey, "s3 key doesn't match")
+}
+
+func TestPending(t *testing.T) {
+	dy := &Dynamo{
+		client: &test.MockDynamoDB{
+			Err: errors.New("error"),
+		},
+	}
+
+	_, err := dy.Pending()
+	assert.Error(t, err)
+
+	m := NewMemory(it, &Item{S3ObjectKey: "p", State: StatePending, ClientToken: "t"})
+	items, err := m.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.True(t, items[0].IsPending())
+
+	items, err = m.All()
+	assert.NoError(t, err)
+	assert.Equal(t, []*Item{it}, items)
+}
+
+func TestAllError(t *testing.T) {
+	dy := &Dynamo{
+		client: &test.MockDynamoDB{
+			Err: errors.New("error"),
+		},
+	}
+
+	_, err := dy.All()
+	assert.Error(t, err)
+}
+
 func TestCreate(t *testing.T) {
 	dy := &Dynamo{
 		client: &test.MockDynamoDB{},
@@ -82,6 +129,17 @@ func TestUpdate(t *testing.T) {
 
 }
 
+func TestUpdatePending(t *testing.T) {
+	dy := &Dynamo{
+		client: &test.MockDynamoDB{},
+	}
+
+	// Only the values given are set
+	assert.NoError(t, dy.Update(&Item{S3ObjectKey: "test", State: StatePending, ClientToken: "token"}))
+	assert.NoError(t, dy.Update(&Item{S3ObjectKey: "test", State: StatePending, ClientToken: "token", PendingSince: "2019-11-01T00:00:00Z"}))
+	assert.NoError(t, dy.Update(&Item{S3ObjectKey: "test", Hash: "hash", Origin: OriginLocal}))
+}
+
 func TestUpdateError(t *testing.T) {
 	dy := &Dynamo{
 		client: &test.MockDynamoDB{
@@ -113,3 +171,112 @@ func TestDeleteError(t *testing.T) {
 	err := dy.Delete(it)
 	assert.Error(t, err)
 }
+
+func TestGetConn(t *testing.T) {
+	assert.IsType(t, &Dynamo{}, GetConn(new(test.MockDynamoDB)))
+
+	m := NewMemory()
+	assert.Equal(t, m, GetConn(m))
+	assert.Nil(t, GetConn("unknown"))
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(it)
+
+	i, err := m.FindByKey("test")
+	assert.NoError(t, err)
+	assert.Equal(t, it, i)
+
+	assert.NoError(t, m.Create(&Item{S3ObjectKey: "a", PolicyId: "a-id"}))
+	assert.True(t, IsConflict(m.Create(&Item{S3ObjectKey: "a", PolicyId: "c-id"})))
+	assert.True(t, IsConflict(m.Update(&Item{S3ObjectKey: "a", PolicyId: "c-id"})))
+	assert.NoError(t, m.Update(&Item{S3ObjectKey: "a", PolicyId: "b-id", Version: 1}))
+
+	items, err := m.All()
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "b-id", items[0].PolicyId)
+
+	assert.NoError(t, m.Delete(items[0]))
+	i, err = m.FindByKey("a")
+	assert.NoError(t, err)
+	assert.Nil(t, i)
+}
+
+func TestUpdateOutOfOrder(t *testing.T) {
+	dy := &Dynamo{
+		client: &test.MockDynamoDB{
+			Payload: map[string]string{
+				"condition": "failed",
+				"found":     "yes",
+				"sequencer": PadSequencer("0B"),
+			},
+		},
+	}
+
+	err := dy.Update(&Item{S3ObjectKey: "test", Sequencer: PadSequencer("0A")})
+	assert.Equal(t, ErrOutOfOrder, err)
+
+	err = dy.Delete(&Item{S3ObjectKey: "test", Sequencer: PadSequencer("0A")})
+	assert.Equal(t, ErrOutOfOrder, err)
+}
+
+func TestUpdateConflict(t *testing.T) {
+	dy := &Dynamo{
+		client: &test.MockDynamoDB{
+			Payload: map[string]string{
+				"condition": "failed",
+				"found":     "yes",
+			},
+		},
+	}
+
+	i := &Item{S3ObjectKey: "test", Version: 2}
+	err := dy.Update(i)
+	assert.True(t, IsConflict(err))
+	assert.Equal(t, int64(2), i.Version)
+	assert.True(t, IsConflict(dy.Create(&Item{S3ObjectKey: "test"})))
+	assert.True(t, IsConflict(dy.Delete(i)))
+
+	// Successful writes move the version on
+	dy = &Dynamo{client: &test.MockDynamoDB{}}
+	assert.NoError(t, dy.Update(i))
+	assert.Equal(t, int64(3), i.Version)
+	assert.NoError(t, dy.Create(i))
+	assert.Equal(t, int64(1), i.Version)
+}
+
+func TestPadSequencer(t *testing.T) {
+	assert.Equal(t, "", PadSequencer(""))
+	assert.Equal(t, "0A000000000000000000000000000000", PadSequencer("0A"))
+
+	// The longer sequencer isn't necessarily the later one
+	assert.True(t, PadSequencer("FF") > PadSequencer("0055AED6DCD90281E5"))
+	assert.True(t, PadSequencer("0055AED6DCD90281E6") > PadSequencer("0055AED6DCD90281E5"))
+}
+
+func TestMemorySequencer(t *testing.T) {
+	m := NewMemory()
+
+	assert.NoError(t, m.Create(&Item{S3ObjectKey: "a", PolicyId: "a-id", Sequencer: PadSequencer("0B")}))
+	assert.Equal(t, ErrOutOfOrder, m.Update(&Item{S3ObjectKey: "a", Sequencer: PadSequencer("0A"), Version: 1}))
+
+	// The same event can write again, e.g. after claiming the record
+	assert.NoError(t, m.Update(&Item{S3ObjectKey: "a", PolicyId: "a-id", Sequencer: PadSequencer("0B"), Version: 1}))
+
+	// Updates without an event keep the last one
+	assert.NoError(t, m.Update(&Item{S3ObjectKey: "a", PolicyId: "b-id", Version: 2}))
+	i, err := m.FindByKey("a")
+	assert.NoError(t, err)
+	assert.Equal(t, PadSequencer("0B"), i.Sequencer)
+
+	// Tombstones are found by key but not listed
+	assert.NoError(t, m.Delete(&Item{S3ObjectKey: "a", Sequencer: PadSequencer("0C"), Version: 3}))
+	i, err = m.FindByKey("a")
+	assert.NoError(t, err)
+	assert.True(t, i.Deleted)
+
+	items, err := m.All()
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"sort"
+	"sync"
+)
+
+// In memory database. Used to run the processors
+// locally without DynamoDB.
+type Memory struct {
+	mu    sync.Mutex
+	items map[string]Item
+}
+
+// New in memory database holding the given items
+func NewMemory(items ...*Item) *Memory {
+	m := &Memory{items: make(map[string]Item)}
+	for _, i := range items {
+		m.items[i.S3ObjectKey] = *i
+	}
+
+	return m
+}
+
+// Search by key
+func (m *Memory) FindByKey(k string) (*Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i, ok := m.items[k]; ok {
+		return &i, nil
+	}
+
+	return nil, nil
+}
+
+// List all records sorted by key, except tombstones
+// and pending ones
+func (m *Memory) All() ([]*Item, error) {
+	return m.list(func(i *Item) bool {
+		return !i.Deleted && !i.IsPending()
+	})
+}
+
+// List the pending records sorted by key
+func (m *Memory) Pending() ([]*Item, error) {
+	return m.list((*Item).IsPending)
+}
+
+// List the records matching the filter sorted by key
+func (m *Memory) list(filter func(*Item) bool) ([]*Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []*Item
+	for _, i := range m.items {
+		if !filter(&i) {
+			continue
+		}
+
+		i := i
+		items = append(items, &i)
+	}
+
+	sort.Slice(items, func(a, b int) bool {
+		return items[a].S3ObjectKey < items[b].S3ObjectKey
+	})
+
+	return items, nil
+}
+
+// Create a record, unless there is one other than a
+// tombstone. The item gets the first version.
+func (m *Memory) Create(i *Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.items[i.S3ObjectKey]
+	if ok && !old.Deleted {
+		return &ConflictError{Key: i.S3ObjectKey, Version: i.Version}
+	}
+
+	if err := m.check(i, old.Version); err != nil {
+		return err
+	}
+
+	i.Version = 1
+	m.items[i.S3ObjectKey] = *i
+
+	return nil
+}
+
+// Update a record if it's still at the item's version.
+// The item gets the next version.
+func (m *Memory) Update(i *Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.items[i.S3ObjectKey]
+	if err := m.check(i, i.Version); err != nil {
+		return err
+	}
+
+	// Like DynamoDB, keep the last event if none is given
+	u := *i
+	if u.Sequencer == "" {
+		u.Sequencer, u.EventTime = old.Sequencer, old.EventTime
+	}
+
+	u.Version++
+	m.items[i.S3ObjectKey] = u
+	i.Version = u.Version
+
+	return nil
+}
+
+// Delete a record if it's still at the item's version,
+// leaving a tombstone if the item has a sequencer
+func (m *Memory) Delete(i *Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(i, i.Version); err != nil {
+		return err
+	}
+
+	if i.Sequencer != "" {
+		m.items[i.S3ObjectKey] = *tombstone(i)
+		return nil
+	}
+
+	delete(m.items, i.S3ObjectKey)
+
+	return nil
+}
+
+// Check the event order and the expected version of a write
+func (m *Memory) check(i *Item, version int64) error {
+	old := m.items[i.S3ObjectKey]
+	if i.Sequencer != "" && old.Sequencer > i.Sequencer {
+		return ErrOutOfOrder
+	}
+
+	if old.Version != version {
+		return &ConflictError{Key: i.S3ObjectKey, Version: i.Version}
+	}
+
+	return nil
+}
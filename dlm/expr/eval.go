@@ -0,0 +1,495 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Built-in functions. They can also be called on
+// their first argument, e.g. key.startsWith("prod/")
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	"len":        fnLen,
+	"has":        fnHas,
+	"contains":   fnContains,
+	"startsWith": stringFn(strings.HasPrefix),
+	"endsWith":   stringFn(strings.HasSuffix),
+	"matches":    fnMatches,
+	"lower":      fnLower,
+	"upper":      fnUpper,
+}
+
+// Evaluation scope. Macro variables shadow
+// the environment.
+type scope struct {
+	vars   map[string]interface{}
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (interface{}, bool) {
+	for c := s; c != nil; c = c.parent {
+		if v, ok := c.vars[name]; ok {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+func eval(n node, s *scope) (interface{}, error) {
+	switch n := n.(type) {
+	case literalNode:
+		return n.value, nil
+	case identNode:
+		v, ok := s.lookup(n.name)
+		if !ok {
+			return nil, fmt.Errorf("undefined variable %s", n.name)
+		}
+
+		return v, nil
+	case memberNode:
+		x, err := eval(n.x, s)
+		if err != nil {
+			return nil, err
+		}
+
+		return member(x, n.name)
+	case indexNode:
+		return evalIndex(n, s)
+	case listNode:
+		var list []interface{}
+		for _, i := range n.items {
+			v, err := eval(i, s)
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, v)
+		}
+
+		return list, nil
+	case unaryNode:
+		return evalUnary(n, s)
+	case binaryNode:
+		return evalBinary(n, s)
+	case callNode:
+		return call(n.name, n.args, nil, s)
+	case methodNode:
+		if n.name == "all" || n.name == "exists" {
+			return evalMacro(n, s)
+		}
+
+		return call(n.name, n.args, n.x, s)
+	}
+
+	return nil, fmt.Errorf("unknown node %T", n)
+}
+
+// Field of a map. Missing fields are null.
+func member(x interface{}, name string) (interface{}, error) {
+	switch m := x.(type) {
+	case map[string]interface{}:
+		return m[name], nil
+	case nil:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("can't access field %s of %s", name, typeName(x))
+}
+
+func evalIndex(n indexNode, s *scope) (interface{}, error) {
+	x, err := eval(n.x, s)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := eval(n.index, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := x.(type) {
+	case []interface{}:
+		f, ok := i.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("list index must be an integer, got %s", typeName(i))
+		}
+
+		if int(f) < 0 || int(f) >= len(c) {
+			return nil, fmt.Errorf("index %d out of range of list of length %d", int(f), len(c))
+		}
+
+		return c[int(f)], nil
+	case map[string]interface{}:
+		k, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be a string, got %s", typeName(i))
+		}
+
+		return c[k], nil
+	case nil:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("can't index %s", typeName(x))
+}
+
+func evalUnary(n unaryNode, s *scope) (interface{}, error) {
+	x, err := eval(n.x, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "!":
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator ! needs a bool, got %s", typeName(x))
+		}
+
+		return !b, nil
+	case "-":
+		f, ok := x.(float64)
+		if !ok {
+			return nil, fmt.Errorf("operator - needs a number, got %s", typeName(x))
+		}
+
+		return -f, nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func evalBinary(n binaryNode, s *scope) (interface{}, error) {
+	l, err := eval(n.l, s)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short circuit logical operators
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s needs bools, got %s", n.op, typeName(l))
+		}
+
+		if (n.op == "&&" && !lb) || (n.op == "||" && lb) {
+			return lb, nil
+		}
+
+		r, err := eval(n.r, s)
+		if err != nil {
+			return nil, err
+		}
+
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s needs bools, got %s", n.op, typeName(r))
+		}
+
+		return rb, nil
+	}
+
+	r, err := eval(n.r, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	case "in":
+		return fnContains([]interface{}{r, l})
+	case "+":
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return ls + rs, nil
+			}
+		}
+	}
+
+	// Ordering works on strings too
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			switch n.op {
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s can't be applied to %s and %s", n.op, typeName(l), typeName(r))
+	}
+
+	switch n.op {
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+
+		return math.Mod(lf, rf), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+// Evaluate list.all(v, predicate) and list.exists(v, predicate)
+func evalMacro(n methodNode, s *scope) (interface{}, error) {
+	if len(n.args) != 2 {
+		return nil, fmt.Errorf("%s needs a variable and a predicate", n.name)
+	}
+
+	v, ok := n.args[0].(identNode)
+	if !ok {
+		return nil, fmt.Errorf("first argument of %s must be a variable name", n.name)
+	}
+
+	x, err := eval(n.x, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []interface{}
+	switch c := x.(type) {
+	case []interface{}:
+		list = c
+	case nil:
+	default:
+		return nil, fmt.Errorf("%s needs a list, got %s", n.name, typeName(x))
+	}
+
+	for _, item := range list {
+		r, err := eval(n.args[1], &scope{vars: map[string]interface{}{v.name: item}, parent: s})
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("predicate of %s must be a bool, got %s", n.name, typeName(r))
+		}
+
+		if n.name == "all" && !b {
+			return false, nil
+		}
+
+		if n.name == "exists" && b {
+			return true, nil
+		}
+	}
+
+	return n.name == "all", nil
+}
+
+// Call a built-in function. The receiver, if any,
+// is passed as the first argument.
+func call(name string, argNodes []node, receiver node, s *scope) (interface{}, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined function %s", name)
+	}
+
+	if receiver != nil {
+		argNodes = append([]node{receiver}, argNodes...)
+	}
+
+	var args []interface{}
+	for _, a := range argNodes {
+		v, err := eval(a, s)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, v)
+	}
+
+	v, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return v, nil
+}
+
+func fnLen(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("needs 1 argument")
+	}
+
+	switch v := args[0].(type) {
+	case string:
+		return float64(len(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	case nil:
+		return float64(0), nil
+	}
+
+	return nil, fmt.Errorf("can't get length of %s", typeName(args[0]))
+}
+
+func fnHas(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("needs 1 argument")
+	}
+
+	return args[0] != nil, nil
+}
+
+// contains(list, item) or contains(string, substring)
+func fnContains(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("needs 2 arguments")
+	}
+
+	switch c := args[0].(type) {
+	case string:
+		sub, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("can't search %s in a string", typeName(args[1]))
+		}
+
+		return strings.Contains(c, sub), nil
+	case []interface{}:
+		for _, i := range c {
+			if reflect.DeepEqual(i, args[1]) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case map[string]interface{}:
+		k, ok := args[1].(string)
+		if !ok {
+			return false, nil
+		}
+
+		_, found := c[k]
+		return found, nil
+	case nil:
+		return false, nil
+	}
+
+	return nil, fmt.Errorf("can't search in %s", typeName(args[0]))
+}
+
+func fnMatches(args []interface{}) (interface{}, error) {
+	s, pattern, err := twoStrings(args)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return re.MatchString(s), nil
+}
+
+func fnLower(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("needs 1 argument")
+	}
+
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("needs a string, got %s", typeName(args[0]))
+	}
+
+	return strings.ToLower(s), nil
+}
+
+func fnUpper(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("needs 1 argument")
+	}
+
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("needs a string, got %s", typeName(args[0]))
+	}
+
+	return strings.ToUpper(s), nil
+}
+
+// Wrap a string predicate
+func stringFn(f func(string, string) bool) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		a, b, err := twoStrings(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return f(a, b), nil
+	}
+}
+
+func twoStrings(args []interface{}) (string, string, error) {
+	if len(args) != 2 {
+		return "", "", fmt.Errorf("needs 2 arguments")
+	}
+
+	a, ok := args[0].(string)
+	b, ok2 := args[1].(string)
+	if !ok || !ok2 {
+		return "", "", fmt.Errorf("needs strings, got %s and %s", typeName(args[0]), typeName(args[1]))
+	}
+
+	return a, b, nil
+}
+
+// Name of a value type for error messages
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,103 @@
+// Package expr is a small expression language for
+// writing custom policy rules.
+//
+// It supports numbers, strings, bools, null and lists,
+// field access (policy.State), indexing (tags[0]),
+// arithmetic (+ - * / %), comparison (== != < <= > >=),
+// logic (&& || !), membership (x in list), the functions
+// len, has, contains, startsWith, endsWith, matches,
+// lower and upper, and the list macros all and exists:
+//
+//	policy.PolicyDetails.TargetTags.exists(t, t.Key == "Env" && t.Value == "prod")
+package expr
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Compiled expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse an expression
+func Compile(src string) (*Expr, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile expression %q: %v", src, err)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// Source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Evaluate the expression against the variables.
+// Variables must hold values made of maps with string
+// keys, lists, strings, bools and numbers. Use
+// Normalize to convert decoded yaml or json.
+func (e *Expr) Eval(vars map[string]interface{}) (interface{}, error) {
+	return eval(e.root, &scope{vars: vars})
+}
+
+// Evaluate an expression that must return a bool
+func (e *Expr) EvalBool(vars map[string]interface{}) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q returned %s instead of bool", e.src, typeName(v))
+	}
+
+	return b, nil
+}
+
+// Normalize converts a decoded value into the types
+// the evaluator understands: map keys become strings,
+// every number becomes float64 and typed slices and
+// maps become generic ones.
+func Normalize(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = Normalize(rv.MapIndex(k).Interface())
+		}
+
+		return m
+	case reflect.Slice, reflect.Array:
+		l := make([]interface{}, rv.Len())
+		for i := range l {
+			l[i] = Normalize(rv.Index(i).Interface())
+		}
+
+		return l
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+
+		return Normalize(rv.Elem().Interface())
+	}
+
+	return v
+}
@@ -0,0 +1,85 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var vars = Normalize(map[string]interface{}{
+	"object": map[string]interface{}{
+		"Key": "prod/web.yaml",
+	},
+	"policy": map[interface{}]interface{}{
+		"State": "ENABLED",
+		"PolicyDetails": map[interface{}]interface{}{
+			"TargetTags": []interface{}{
+				map[interface{}]interface{}{"Key": "Env", "Value": "prod"},
+			},
+			"Schedules": []interface{}{
+				map[interface{}]interface{}{
+					"CreateRule": map[interface{}]interface{}{"Interval": 12},
+					"RetainRule": map[interface{}]interface{}{"Count": 7},
+				},
+			},
+		},
+	},
+}).(map[string]interface{})
+
+func TestEvalBool(t *testing.T) {
+	cases := map[string]bool{
+		`policy.State == "ENABLED"`: true,
+		`object.Key.startsWith("prod/") && 24 / policy.PolicyDetails.Schedules[0].CreateRule.Interval >= 2`: true,
+		`startsWith(object.Key, "dev/")`: false,
+		`policy.PolicyDetails.TargetTags.exists(t, t.Key == "Env" && t.Value == "prod")`: true,
+		`policy.PolicyDetails.Schedules.all(s, s.RetainRule.Count >= 14)`:                false,
+		`len(policy.PolicyDetails.TargetTags) == 1`:                                      true,
+		`!has(policy.Description)`:                                                       true,
+		`policy.State in ["ENABLED", "DISABLED"]`:                                        true,
+		`object.Key.matches("^prod/[a-z]+\\.yaml$")`:                                     true,
+		`-1 + 2 * 3 % 4 == 1`:                                                            true,
+		`lower("ABC") + upper("d") == 'abcD'`:                                            true,
+		`"b" > "a" || undefined`:                                                         true,
+	}
+
+	for src, expected := range cases {
+		e, err := Compile(src)
+		if assert.NoError(t, err, src) {
+			actual, err := e.EvalBool(vars)
+			assert.NoError(t, err, src)
+			assert.Equal(t, expected, actual, src)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, src := range []string{`policy.`, `(1 + 2`, `"open`, `1 ~ 2`, `a b`} {
+		_, err := Compile(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	for _, src := range []string{
+		`undefined == 1`,
+		`policy.State > 1`,
+		`policy.PolicyDetails.Schedules[5]`,
+		`unknown(1)`,
+		`1 / 0`,
+		`policy.State && true`,
+	} {
+		e, err := Compile(src)
+		if assert.NoError(t, err, src) {
+			_, err = e.Eval(vars)
+			assert.Error(t, err, src)
+		}
+	}
+}
+
+func TestEvalBoolNotBool(t *testing.T) {
+	e, err := Compile(`policy.State`)
+	assert.NoError(t, err)
+
+	_, err = e.EvalBool(vars)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+// Lexical token
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+// Operators, longest first so they win over their prefix
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"<", ">", "!", "+", "-", "*", "/", "%",
+	"(", ")", "[", "]", ".", ",",
+}
+
+// Split the source into tokens
+func tokenize(src string) ([]token, error) {
+	var toks []token
+
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", src[start:i], start)
+			}
+
+			toks = append(toks, token{kind: tokNumber, text: src[start:i], num: n, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(src) && rune(src[i]) != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+			}
+
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+
+			i++
+			toks = append(toks, token{kind: tokString, text: sb.String(), pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
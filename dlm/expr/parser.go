@@ -0,0 +1,313 @@
+package expr
+
+import (
+	"fmt"
+)
+
+// Syntax tree node
+type node interface{}
+
+type (
+	literalNode struct {
+		value interface{}
+	}
+
+	identNode struct {
+		name string
+	}
+
+	memberNode struct {
+		x    node
+		name string
+	}
+
+	indexNode struct {
+		x     node
+		index node
+	}
+
+	listNode struct {
+		items []node
+	}
+
+	unaryNode struct {
+		op string
+		x  node
+	}
+
+	binaryNode struct {
+		op   string
+		l, r node
+	}
+
+	// Global function such as len(x)
+	callNode struct {
+		name string
+		args []node
+	}
+
+	// Function called on a value such as x.all(i, i > 1)
+	methodNode struct {
+		x    node
+		name string
+		args []node
+	}
+)
+
+// Recursive descent parser. Operator precedence from
+// the lowest: ||, &&, comparison and in, + -, * / %,
+// unary ! -, then member access, index and calls.
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func parse(src string) (node, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+// Consume the operator if it's next
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d, got %q", op, t.pos, t.text)
+	}
+
+	return nil
+}
+
+// Parse a left associative binary level
+func (p *parser) binary(ops []string, operand func() (node, error)) (node, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		matched := ""
+		for _, op := range ops {
+			t := p.peek()
+			if (t.kind == tokOp || t.kind == tokIdent) && t.text == op {
+				matched = op
+				break
+			}
+		}
+
+		if matched == "" {
+			return l, nil
+		}
+
+		p.next()
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+
+		l = binaryNode{op: matched, l: l, r: r}
+	}
+}
+
+func (p *parser) or() (node, error) {
+	return p.binary([]string{"||"}, p.and)
+}
+
+func (p *parser) and() (node, error) {
+	return p.binary([]string{"&&"}, p.comparison)
+}
+
+func (p *parser) comparison() (node, error) {
+	return p.binary([]string{"==", "!=", "<=", ">=", "<", ">", "in"}, p.additive)
+}
+
+func (p *parser) additive() (node, error) {
+	return p.binary([]string{"+", "-"}, p.multiplicative)
+}
+
+func (p *parser) multiplicative() (node, error) {
+	return p.binary([]string{"*", "/", "%"}, p.unary)
+}
+
+func (p *parser) unary() (node, error) {
+	for _, op := range []string{"!", "-"} {
+		if p.accept(op) {
+			x, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+
+			return unaryNode{op: op, x: x}, nil
+		}
+	}
+
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at %d", t.pos)
+			}
+
+			if p.accept("(") {
+				args, err := p.args()
+				if err != nil {
+					return nil, err
+				}
+
+				x = methodNode{x: x, name: t.text, args: args}
+			} else {
+				x = memberNode{x: x, name: t.text}
+			}
+		case p.accept("["):
+			i, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+
+			if err = p.expect("]"); err != nil {
+				return nil, err
+			}
+
+			x = indexNode{x: x, index: i}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// Parse call arguments after the opening parenthesis
+func (p *parser) args() ([]node, error) {
+	var args []node
+	if p.accept(")") {
+		return args, nil
+	}
+
+	for {
+		a, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, a)
+
+		if p.accept(")") {
+			return args, nil
+		}
+
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokNumber:
+		return literalNode{value: t.num}, nil
+	case tokString:
+		return literalNode{value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+
+		if p.accept("(") {
+			args, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+
+			return callNode{name: t.text, args: args}, nil
+		}
+
+		return identNode{name: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+
+			return x, p.expect(")")
+		case "[":
+			var items []node
+			if p.accept("]") {
+				return listNode{items: items}, nil
+			}
+
+			for {
+				i, err := p.or()
+				if err != nil {
+					return nil, err
+				}
+
+				items = append(items, i)
+
+				if p.accept("]") {
+					return listNode{items: items}, nil
+				}
+
+				if err = p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
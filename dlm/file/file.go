@@ -1,6 +1,7 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,18 +10,25 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 	"gopkg.in/yaml.v2"
 )
 
 const cacheDir = "/tmp"
 
+// Objects holding configuration rather than policies
+const (
+	GuardrailsName = "_guardrails.yaml"
+	RulesName      = "_rules.yaml"
+)
+
 // Unmarshal yaml file from local directory after downloaded it
 func UnmarshalPolicyFromS3(record events.S3EventRecord, downloader s3manageriface.DownloaderAPI) (*Policy, error) {
 	localFile := filepath.Join(cacheDir, record.S3.Object.Key)
 
-	// Download file to lambda container temperarily
-	if err := S3Downloader(localFile, record.S3.Bucket.Name, record.S3.Object.Key, downloader); err != nil {
+	// Download the version of the event to lambda container temperarily
+	if err := S3Downloader(localFile, record.S3.Bucket.Name, record.S3.Object.Key, record.S3.Object.VersionID, downloader); err != nil {
 		return nil, err
 	}
 
@@ -29,16 +37,32 @@ func UnmarshalPolicyFromS3(record events.S3EventRecord, downloader s3managerifac
 		return nil, err
 	}
 
+	return Parse(raw)
+}
+
+// Parse policy file content
+func Parse(raw []byte) (*Policy, error) {
 	p := new(Policy)
-	if err = yaml.Unmarshal(raw, p); err != nil {
+	if err := yaml.Unmarshal(raw, p); err != nil {
 		return nil, err
 	}
 
 	return p, nil
 }
 
-// Download file from S3 bucket
-func S3Downloader(fileName, bucket, key string, downloader s3manageriface.DownloaderAPI) error {
+// Marshal policy into the canonical format
+func Marshal(p *Policy) ([]byte, error) {
+	raw, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return Format(raw)
+}
+
+// Download file from S3 bucket.
+// The latest version if the version id is empty.
+func S3Downloader(fileName, bucket, key, versionId string, downloader s3manageriface.DownloaderAPI) error {
 	// Create a file to write the S3 Object contents to.
 	if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
 		return err
@@ -49,11 +73,17 @@ func S3Downloader(fileName, bucket, key string, downloader s3manageriface.Downlo
 		return fmt.Errorf("failed to create file %q, %v", fileName, err)
 	}
 
-	// Write the contents of S3 Object to the file
-	_, err = downloader.Download(f, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
-	})
+	}
+
+	if versionId != "" {
+		input.VersionId = aws.String(versionId)
+	}
+
+	// Write the contents of S3 Object to the file
+	_, err = downloader.Download(f, input)
 
 	if err != nil {
 		return fmt.Errorf("failed to download file, %v", err)
@@ -61,3 +91,53 @@ func S3Downloader(fileName, bucket, key string, downloader s3manageriface.Downlo
 
 	return nil
 }
+
+// Download an object from S3 bucket into memory.
+// The error is returned as is so callers can
+// check the AWS error code.
+func Download(bucket, key string, downloader s3manageriface.DownloaderAPI) ([]byte, error) {
+	return DownloadVersion(bucket, key, "", downloader)
+}
+
+// Download a version of an object from S3 bucket into
+// memory. The latest version if the version id is empty.
+func DownloadVersion(bucket, key, versionId string, downloader s3manageriface.DownloaderAPI) ([]byte, error) {
+	buf := aws.NewWriteAtBuffer([]byte{})
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	if versionId != "" {
+		input.VersionId = aws.String(versionId)
+	}
+
+	_, err := downloader.Download(buf, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Upload content to S3 bucket
+func Upload(bucket, key string, raw []byte, uploader s3manageriface.UploaderAPI) error {
+	_, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(raw),
+		ContentType: aws.String("application/x-yaml"),
+	})
+
+	return err
+}
+
+// If the object is a reserved configuration object
+// such as the guardrails rather than a policy. Only
+// the objects at the root of the bucket are loaded,
+// e.g. team/_rules.yaml is a policy.
+func IsReserved(key string) bool {
+	return key == GuardrailsName || key == RulesName
+}
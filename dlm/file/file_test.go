@@ -23,7 +23,7 @@ var (
 )
 
 func TestS3Downloader(t *testing.T) {
-	err := S3Downloader(test.DestTestFile, record.S3.Bucket.Name, record.S3.Object.Key, new(test.MockDownloader))
+	err := S3Downloader(test.DestTestFile, record.S3.Bucket.Name, record.S3.Object.Key, "", new(test.MockDownloader))
 	assert.NoError(t, err)
 
 	//Clean up test file
@@ -41,3 +41,41 @@ func TestUnmarshalPolicyFromS3(t *testing.T) {
 	err = test.DeleteFile(test.DestTestFile)
 	assert.NoError(t, err)
 }
+
+func TestUnmarshalPolicyFromS3Version(t *testing.T) {
+	r := record
+	r.S3.Object.VersionID = "v1"
+
+	p, err := UnmarshalPolicyFromS3(r, &test.MockDownloader{
+		Objects: map[string]string{test.PolicyExampleFileName + "?versionId=v1": "Description: Version one\n"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Version one", p.Description)
+
+	assert.NoError(t, test.DeleteFile(test.DestTestFile))
+}
+
+func TestDownload(t *testing.T) {
+	raw, err := Download(record.S3.Bucket.Name, record.S3.Object.Key, new(test.MockDownloader))
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "PolicyDetails")
+}
+
+func TestIsReserved(t *testing.T) {
+	assert.True(t, IsReserved("_guardrails.yaml"))
+	assert.True(t, IsReserved("_rules.yaml"))
+	assert.False(t, IsReserved("team/_rules.yaml"))
+	assert.False(t, IsReserved("team/policy.yaml"))
+	assert.False(t, IsReserved("_prod.yaml"))
+}
+
+func TestParseLegacyTag(t *testing.T) {
+	p, err := Parse([]byte("PolicyDetails:\n  Schedules:\n  - Name: Daily\n    Tag:\n    - Key: Old\n      Value: tag\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []*Tag{{Key: "Old", Value: "tag"}}, p.PolicyDetails.Schedules[0].TagsToAdd)
+
+	// TagsToAdd wins
+	p, err = Parse([]byte("PolicyDetails:\n  Schedules:\n  - Name: Daily\n    Tag:\n    - Key: Old\n      Value: tag\n    TagsToAdd:\n    - Key: New\n      Value: tag\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []*Tag{{Key: "New", Value: "tag"}}, p.PolicyDetails.Schedules[0].TagsToAdd)
+}
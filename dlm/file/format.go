@@ -0,0 +1,345 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Indentation of the canonical format
+const formatIndent = 2
+
+// Returned when a file has no yaml document, e.g.
+// only comments
+var ErrEmptyFile = errors.New("Failed to format. Empty policy file")
+
+// Format rewrites a policy file into the canonical
+// format: keys follow the order of the policy structs,
+// indentation is two spaces, mappings and lists are in
+// block style, list items start at the indentation of
+// their key and Times are double quoted. Comments are
+// kept in place, inline comments aligned in the source
+// stay aligned.
+func Format(src []byte) ([]byte, error) {
+	dec := yamlv3.NewDecoder(bytes.NewReader(src))
+
+	var out bytes.Buffer
+	out.WriteString("---\n")
+
+	enc := yamlv3.NewEncoder(&out)
+	enc.SetIndent(formatIndent)
+
+	lines := strings.Split(string(src), "\n")
+	var comments []inlineComment
+	for {
+		doc := new(yamlv3.Node)
+		if err := dec.Decode(doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		if len(doc.Content) == 0 || isNull(doc.Content[0]) {
+			continue
+		}
+
+		root := doc.Content[0]
+		var header string
+		if root.Kind == yamlv3.MappingNode && len(root.Content) > 0 {
+			// The comment above the first key is the file header
+			header, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+		}
+
+		canonicalise(root, reflect.TypeOf(Policy{}))
+		comments = markComments(doc, lines, comments)
+
+		if header != "" {
+			root.Content[0].HeadComment = joinComments(header, root.Content[0].HeadComment)
+		}
+
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	// Nothing encoded, the encoder can't be closed
+	if out.Len() == len("---\n") {
+		return nil, ErrEmptyFile
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	compact, err := compactSequences(out.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return alignComments(compact, comments), nil
+}
+
+// If the node is an empty document, e.g. only comments
+func isNull(n *yamlv3.Node) bool {
+	return n.Kind == yamlv3.ScalarNode && n.Tag == "!!null" && n.Value == ""
+}
+
+// Reorder the keys of a mapping node following the
+// fields of the given type, recursing into nested
+// structs and lists. Unknown keys are kept after the
+// known ones in their original order.
+func canonicalise(n *yamlv3.Node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case n.Kind == yamlv3.SequenceNode && t.Kind() == reflect.Slice:
+		for _, c := range n.Content {
+			canonicalise(c, t.Elem())
+		}
+	case n.Kind == yamlv3.MappingNode && t.Kind() == reflect.Struct:
+		var ordered []*yamlv3.Node
+		used := make([]bool, len(n.Content)/2)
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _ := yamlName(f)
+
+			for j := 0; j+1 < len(n.Content); j += 2 {
+				if used[j/2] || n.Content[j].Value != name {
+					continue
+				}
+
+				used[j/2] = true
+				key, value := n.Content[j], n.Content[j+1]
+				canonicalise(value, f.Type)
+
+				if t == reflect.TypeOf(CreateRule{}) && name == "Times" {
+					quoteScalars(value)
+				}
+
+				ordered = append(ordered, key, value)
+			}
+		}
+
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if !used[j/2] {
+				ordered = append(ordered, n.Content[j], n.Content[j+1])
+			}
+		}
+
+		n.Content = ordered
+	}
+}
+
+// Join two comment blocks
+func joinComments(a, b string) string {
+	if b == "" {
+		return a
+	}
+
+	return a + "\n" + b
+}
+
+// Double quote every scalar of a sequence
+func quoteScalars(n *yamlv3.Node) {
+	if n.Kind != yamlv3.SequenceNode {
+		return
+	}
+
+	for _, c := range n.Content {
+		if c.Kind == yamlv3.ScalarNode {
+			c.Style = yamlv3.DoubleQuotedStyle
+			c.Tag = "!!str"
+		}
+	}
+}
+
+// Inline comment and the column it starts at in the
+// source, -1 if unknown
+type inlineComment struct {
+	text   string
+	column int
+}
+
+// Placeholder of the inline comment at an index
+const commentMark = "#adlm-fmt:"
+
+// Replace the inline comments of the nodes, in block
+// style, with placeholders so they can be aligned once
+// the document is encoded
+func markComments(n *yamlv3.Node, lines []string, comments []inlineComment) []inlineComment {
+	if n.Kind == yamlv3.MappingNode || n.Kind == yamlv3.SequenceNode {
+		n.Style &^= yamlv3.FlowStyle
+	}
+
+	if n.LineComment != "" {
+		column := -1
+		if n.Line > 0 && n.Line <= len(lines) {
+			line := lines[n.Line-1]
+			if i := strings.LastIndex(line, n.LineComment); i >= 0 {
+				column = utf8.RuneCountInString(line[:i])
+			}
+		}
+
+		comments = append(comments, inlineComment{n.LineComment, column})
+		n.LineComment = commentMark + strconv.Itoa(len(comments)-1)
+	}
+
+	for _, c := range n.Content {
+		comments = markComments(c, lines, comments)
+	}
+
+	return comments
+}
+
+// Put the inline comments back. Comments that started
+// at the same column in the source are aligned after the
+// longest of their lines, or at that column if it's
+// further. Others follow their line after a space.
+func alignComments(out []byte, comments []inlineComment) []byte {
+	lines := strings.Split(string(out), "\n")
+
+	type marked struct {
+		line    int
+		content string
+		comment inlineComment
+	}
+
+	var found []marked
+	width := make(map[int]int)
+	count := make(map[int]int)
+	for i, line := range lines {
+		j := strings.Index(line, commentMark)
+		if j < 0 {
+			continue
+		}
+
+		index, err := strconv.Atoi(line[j+len(commentMark):])
+		if err != nil || index >= len(comments) {
+			continue
+		}
+
+		m := marked{i, strings.TrimRight(line[:j], " "), comments[index]}
+		found = append(found, m)
+
+		if c := m.comment.column; c >= 0 {
+			count[c]++
+			if w := utf8.RuneCountInString(m.content) + 1; w > width[c] {
+				width[c] = w
+			}
+		}
+	}
+
+	for _, m := range found {
+		pad := 1
+		if c := m.comment.column; c >= 0 && count[c] > 1 {
+			column := c
+			if width[c] > column {
+				column = width[c]
+			}
+
+			pad = column - utf8.RuneCountInString(m.content)
+		}
+
+		lines[m.line] = m.content + strings.Repeat(" ", pad) + m.comment.text
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Outdent the lists of mappings to the indentation of
+// their key, as the encoder always indents them
+func compactSequences(out []byte) ([]byte, error) {
+	lines := strings.Split(string(out), "\n")
+	outdent := make([]int, len(lines))
+
+	var walk func(n *yamlv3.Node)
+	walk = func(n *yamlv3.Node) {
+		if n.Kind == yamlv3.MappingNode {
+			for i := 1; i < len(n.Content); i += 2 {
+				if v := n.Content[i]; v.Kind == yamlv3.SequenceNode && v.Style&yamlv3.FlowStyle == 0 && len(v.Content) > 0 {
+					outdentItems(lines, outdent, v.Content[0].Line-1)
+				}
+			}
+		}
+
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+
+	dec := yamlv3.NewDecoder(bytes.NewReader(out))
+	for {
+		doc := new(yamlv3.Node)
+		if err := dec.Decode(doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		walk(doc)
+	}
+
+	for i, n := range outdent {
+		if n > 0 {
+			lines[i] = lines[i][n:]
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// Outdent the lines of the list whose first item is at
+// the given line, including the comments above it
+func outdentItems(lines []string, outdent []int, first int) {
+	if first < 0 || first >= len(lines) {
+		return
+	}
+
+	dash := indentOf(lines[first])
+
+	start := first
+	for start > 0 && isComment(lines[start-1]) && indentOf(lines[start-1]) == dash {
+		start--
+	}
+
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		indent := indentOf(line)
+		blank := strings.TrimSpace(line) == ""
+
+		if !blank && indent < dash {
+			break
+		}
+
+		if !blank && indent == dash && !strings.HasPrefix(line[indent:], "-") && !isComment(line) {
+			break
+		}
+
+		if !blank {
+			outdent[i] += formatIndent
+		}
+	}
+}
+
+// Number of leading spaces
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// If the line only holds a comment
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
@@ -0,0 +1,130 @@
+package file
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+const unformatted = `# Team policy
+State: ENABLED
+PolicyDetails:
+    Schedules:
+    - RetainRule:
+        Count: 7
+      Name: Daily  # daily run
+      CreateRule:
+        Times: [01:00, '13:00']
+        IntervalUnit: HOURS
+        Interval: 12
+    ResourceTypes: VOLUME
+    TargetTags:
+    - {Value: app, Key: Name}
+ExecutionRoleArn: arn:aws:iam::123456789101:role/AWSDataLifecycleManagerDefaultRole
+`
+
+const formatted = `---
+# Team policy
+ExecutionRoleArn: arn:aws:iam::123456789101:role/AWSDataLifecycleManagerDefaultRole
+State: ENABLED
+PolicyDetails:
+  ResourceTypes: VOLUME
+  TargetTags:
+  - Key: Name
+    Value: app
+  Schedules:
+  - Name: Daily # daily run
+    CreateRule:
+      Interval: 12
+      IntervalUnit: HOURS
+      Times:
+      - "01:00"
+      - "13:00"
+    RetainRule:
+      Count: 7
+`
+
+// Comments aligned at column 24, pushed by the longer
+// lines once the keys are reordered
+const aligned = `PolicyDetails:
+    Schedules:
+    # Only schedule
+    - RetainRule:
+        Count: 7        # keep a week
+      CreateRule:
+        Interval: 12    # twice a day
+    ResourceTypes: VOLUME # volumes
+State: ENABLED          # on
+`
+
+const alignedFormatted = `---
+State: ENABLED          # on
+PolicyDetails:
+  ResourceTypes: VOLUME # volumes
+  Schedules:
+  # Only schedule
+  - CreateRule:
+      Interval: 12      # twice a day
+    RetainRule:
+      Count: 7          # keep a week
+`
+
+func TestFormat(t *testing.T) {
+	out, err := Format([]byte(unformatted))
+	assert.NoError(t, err)
+	assert.Equal(t, formatted, string(out))
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	for _, f := range []string{formatted, alignedFormatted} {
+		out, err := Format([]byte(f))
+		assert.NoError(t, err)
+		assert.Equal(t, f, string(out))
+	}
+}
+
+func TestFormatAlignsComments(t *testing.T) {
+	out, err := Format([]byte(aligned))
+	assert.NoError(t, err)
+	assert.Equal(t, alignedFormatted, string(out))
+}
+
+// The policy files of the repository are kept formatted
+func TestFormatRepoFiles(t *testing.T) {
+	for _, f := range []string{"../../examples/example.yaml", test.SrcTestFile} {
+		src, err := ioutil.ReadFile(f)
+		assert.NoError(t, err)
+
+		out, err := Format(src)
+		assert.NoError(t, err)
+		assert.Equal(t, string(src), string(out), f)
+	}
+}
+
+func TestFormatKeepsContent(t *testing.T) {
+	src, err := ioutil.ReadFile(test.SrcTestFile)
+	assert.NoError(t, err)
+
+	out, err := Format(src)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "# Can only be \"VOLUME\"")
+
+	before, after := new(Policy), new(Policy)
+	assert.NoError(t, yaml.Unmarshal(src, before))
+	assert.NoError(t, yaml.Unmarshal(out, after))
+	assert.Equal(t, before, after)
+}
+
+func TestFormatError(t *testing.T) {
+	_, err := Format([]byte("Description: [unclosed"))
+	assert.Error(t, err)
+
+	for _, src := range []string{"", "# Only a comment\n", "---\n# Only a comment\n"} {
+		_, err = Format([]byte(src))
+		assert.Equal(t, ErrEmptyFile, err, src)
+	}
+}
@@ -0,0 +1,73 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Extensions of policy files
+var policyExts = []string{".yaml", ".yml"}
+
+// Find the policy files from the given paths.
+// Directories are walked recursively and only yaml
+// files that aren't reserved at their root are picked
+// up from them. Files given explicitly are always returned.
+func Find(paths ...string) ([]string, error) {
+	var files []string
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() || !IsPolicyFile(path) {
+				return nil
+			}
+
+			// Keys are relative to the directory walked
+			rel, err := filepath.Rel(p, path)
+			if err != nil {
+				return err
+			}
+
+			if !IsReserved(filepath.ToSlash(rel)) {
+				files = append(files, path)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// If the file name has a policy file extension
+func IsPolicyFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range policyExts {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
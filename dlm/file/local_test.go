@@ -0,0 +1,30 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adlm-find")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.yaml", "notes.txt", GuardrailsName, "team/" + RulesName} {
+		f := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(f), 0755))
+		assert.NoError(t, ioutil.WriteFile(f, []byte("State: ENABLED\n"), 0644))
+	}
+
+	// Only the reserved files at the root are skipped
+	files, err := Find(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.yaml"),
+		filepath.Join(dir, "team", RulesName),
+	}, files)
+}
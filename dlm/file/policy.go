@@ -22,7 +22,32 @@ type Schedule struct {
 	Name       string      `yaml:"Name"`
 	CreateRule *CreateRule `yaml:"CreateRule"`
 	RetainRule *RetainRule `yaml:"RetainRule"`
-	TagsToAdd  []*Tag      `yaml:"Tag,omitempty"`
+	TagsToAdd  []*Tag      `yaml:"TagsToAdd,omitempty"`
+}
+
+// Read the tags of files written for the Tag key that
+// TagsToAdd replaced. TagsToAdd wins if both are given.
+func (s *Schedule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Schedule
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+
+	if s.TagsToAdd != nil {
+		return nil
+	}
+
+	var legacy struct {
+		Tag []*Tag `yaml:"Tag"`
+	}
+
+	if err := unmarshal(&legacy); err != nil {
+		return err
+	}
+
+	s.TagsToAdd = legacy.Tag
+
+	return nil
 }
 
 type CreateRule struct {
@@ -0,0 +1,271 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	// JSON Schema dialect of the generated schema
+	schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+	// Where the checked-in schema is published
+	SchemaID = "https://raw.githubusercontent.com/liangrog/adlm-helper/master/docs/policy.schema.json"
+)
+
+// Constraints on a policy field that can't be
+// expressed by the yaml tags alone
+type fieldRule struct {
+	Description string
+	Enum        []interface{}
+	Minimum     *int64
+	Maximum     *int64
+	MaxLength   *int
+	Pattern     string
+	MinItems    *int
+	MaxItems    *int
+	ItemPattern string
+}
+
+// Field rules keyed by "<struct name>.<yaml key>".
+// Mirrors the limits documented by the DLM API.
+var fieldRules = map[string]fieldRule{
+	"Policy.Description": {
+		Description: "Description of the lifecycle policy",
+		MaxLength:   intPtr(500),
+		Pattern:     "^[0-9A-Za-z _-]+$",
+	},
+	"Policy.ExecutionRoleArn": {
+		Description: "ARN of the IAM role used to run the operations specified by the lifecycle policy",
+		Pattern:     `^arn:aws(-[a-z]{1,3}){0,2}:iam::\d+:role/[\w+=,.@/-]{1,64}$`,
+	},
+	"Policy.State": {
+		Description: "Desired activation state of the lifecycle policy after creation",
+		Enum:        []interface{}{"ENABLED", "DISABLED"},
+	},
+	"Policy.PolicyDetails": {
+		Description: "Configuration details of the lifecycle policy",
+	},
+	"PolicyDetails.ResourceTypes": {
+		Description: "Resource type to snapshot",
+		Enum:        []interface{}{"VOLUME"},
+	},
+	"PolicyDetails.TargetTags": {
+		Description: "Tags identifying the volumes to snapshot. Each policy must target a unique tag",
+		MinItems:    intPtr(1),
+		MaxItems:    intPtr(50),
+	},
+	"PolicyDetails.Schedules": {
+		Description: "Schedule of the policy. Only one schedule is supported",
+		MinItems:    intPtr(1),
+		MaxItems:    intPtr(1),
+	},
+	"Schedule.Name": {
+		Description: "Name of the schedule",
+		MaxLength:   intPtr(500),
+	},
+	"Schedule.CreateRule": {
+		Description: "When the snapshots are created",
+	},
+	"Schedule.RetainRule": {
+		Description: "How many snapshots are retained",
+	},
+	"Schedule.TagsToAdd": {
+		Description: "Tags added to the snapshots created by the schedule",
+		MaxItems:    intPtr(45),
+	},
+	"CreateRule.Interval": {
+		Description: "Interval between snapshots",
+		Enum:        []interface{}{1, 2, 3, 4, 6, 8, 12, 24},
+	},
+	"CreateRule.IntervalUnit": {
+		Description: "Unit of the interval",
+		Enum:        []interface{}{"HOURS"},
+	},
+	"CreateRule.Times": {
+		Description: "Time in UTC, in 24 hour clock format, the operation occurs within one hour following",
+		MaxItems:    intPtr(1),
+		ItemPattern: "^([01][0-9]|2[0-3]):[0-5][0-9]$",
+	},
+	"RetainRule.Count": {
+		Description: "Number of snapshots to keep for each volume",
+		Minimum:     int64Ptr(1),
+		Maximum:     int64Ptr(1000),
+	},
+	"Tag.Key": {
+		Description: "Tag key",
+		MaxLength:   intPtr(500),
+	},
+	"Tag.Value": {
+		Description: "Tag value",
+		MaxLength:   intPtr(500),
+	},
+}
+
+// JSON Schema document node
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *int64                 `json:"minimum,omitempty"`
+	Maximum              *int64                 `json:"maximum,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*jsonSchema `json:"$defs,omitempty"`
+}
+
+// Schema generates the JSON Schema of the policy file
+// by reflecting over the yaml tags of Policy and its
+// nested types
+func Schema() ([]byte, error) {
+	defs := make(map[string]*jsonSchema)
+
+	root, err := objectSchema(reflect.TypeOf(Policy{}), defs)
+	if err != nil {
+		return nil, err
+	}
+
+	root.Schema = schemaDialect
+	root.ID = SchemaID
+	root.Title = "adlm-helper policy"
+	root.Description = "AWS Data Lifecycle Management policy managed by adlm-helper"
+	root.Defs = defs
+
+	out, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+// Build the schema of a struct, registering
+// nested structs as definitions
+func objectSchema(t reflect.Type, defs map[string]*jsonSchema) (*jsonSchema, error) {
+	s := &jsonSchema{
+		Type:                 "object",
+		Properties:           make(map[string]*jsonSchema),
+		AdditionalProperties: boolPtr(false),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty := yamlName(f)
+		if name == "" {
+			continue
+		}
+
+		prop, err := typeSchema(f.Type, defs)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate schema for %s.%s: %v", t.Name(), f.Name, err)
+		}
+
+		applyRule(prop, fieldRules[t.Name()+"."+name])
+		s.Properties[name] = prop
+
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s, nil
+}
+
+// Map a Go type to its schema
+func typeSchema(t reflect.Type, defs map[string]*jsonSchema) (*jsonSchema, error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), defs)
+	case reflect.String:
+		return &jsonSchema{Type: "string"}, nil
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &jsonSchema{Type: "integer"}, nil
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}, nil
+	case reflect.Slice:
+		items, err := typeSchema(t.Elem(), defs)
+		if err != nil {
+			return nil, err
+		}
+
+		return &jsonSchema{Type: "array", Items: items}, nil
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			// Reserve the name first in case of recursive types
+			defs[t.Name()] = nil
+			def, err := objectSchema(t, defs)
+			if err != nil {
+				return nil, err
+			}
+
+			defs[t.Name()] = def
+		}
+
+		return &jsonSchema{Ref: "#/$defs/" + t.Name()}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// Enrich a property with its field rule
+func applyRule(s *jsonSchema, r fieldRule) {
+	s.Description = r.Description
+	s.Enum = r.Enum
+	s.Minimum = r.Minimum
+	s.Maximum = r.Maximum
+	s.MaxLength = r.MaxLength
+	s.Pattern = r.Pattern
+	s.MinItems = r.MinItems
+	s.MaxItems = r.MaxItems
+
+	if r.ItemPattern != "" && s.Items != nil {
+		s.Items.Pattern = r.ItemPattern
+	}
+}
+
+// Key name and omitempty flag from the yaml tag
+func yamlName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = f.Name
+	}
+
+	omitempty := false
+	for _, p := range parts[1:] {
+		if p == "omitempty" {
+			omitempty = true
+		}
+	}
+
+	return name, omitempty
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,52 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Relative to this package as tests run from its folder
+const checkedInSchema = "../../docs/policy.schema.json"
+
+func TestSchemaUpToDate(t *testing.T) {
+	expected, err := Schema()
+	assert.NoError(t, err)
+
+	actual, err := ioutil.ReadFile(checkedInSchema)
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual), "Schema is out of date with the policy structs. Run `make schema` to regenerate it")
+}
+
+func TestSchemaContent(t *testing.T) {
+	raw, err := Schema()
+	assert.NoError(t, err)
+
+	s := new(jsonSchema)
+	assert.NoError(t, json.Unmarshal(raw, s))
+
+	assert.Equal(t, schemaDialect, s.Schema)
+	assert.ElementsMatch(t, []string{"ExecutionRoleArn", "State", "PolicyDetails"}, s.Required)
+	assert.Equal(t, "#/$defs/PolicyDetails", s.Properties["PolicyDetails"].Ref)
+	assert.Equal(t, []interface{}{"ENABLED", "DISABLED"}, s.Properties["State"].Enum)
+
+	schedule := s.Defs["Schedule"]
+	assert.Contains(t, schedule.Properties, "TagsToAdd")
+	assert.NotContains(t, schedule.Required, "TagsToAdd")
+
+	// Every interval DLM supports
+	interval := s.Defs["CreateRule"].Properties["Interval"]
+	assert.Equal(t, []interface{}{1.0, 2.0, 3.0, 4.0, 6.0, 8.0, 12.0, 24.0}, interval.Enum)
+
+	times := s.Defs["CreateRule"].Properties["Times"]
+	assert.Equal(t, "array", times.Type)
+	assert.Equal(t, "string", times.Items.Type)
+	assert.NotEmpty(t, times.Items.Pattern)
+
+	count := s.Defs["RetainRule"].Properties["Count"]
+	assert.Equal(t, int64(1), *count.Minimum)
+	assert.Equal(t, int64(1000), *count.Maximum)
+}
@@ -0,0 +1,253 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Line number in yaml error messages
+var errLine = regexp.MustCompile(`line (\d+)`)
+
+// Problem found in a policy file
+type Problem struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", p.Line)
+	}
+
+	if p.Field != "" {
+		fmt.Fprintf(&b, "%s: ", p.Field)
+	}
+
+	b.WriteString(p.Message)
+
+	return b.String()
+}
+
+// Validate parses a policy file and checks it against
+// the same rules the JSON Schema is generated from.
+// The policy is only returned when there is no problem.
+func Validate(src []byte) (*Policy, []Problem) {
+	dec := yamlv3.NewDecoder(bytes.NewReader(src))
+
+	doc := new(yamlv3.Node)
+	if err := dec.Decode(doc); err != nil {
+		if err == io.EOF {
+			return nil, []Problem{{Message: "file is empty"}}
+		}
+
+		return nil, []Problem{yamlProblem(err)}
+	}
+
+	if err := dec.Decode(new(yamlv3.Node)); err != io.EOF {
+		return nil, []Problem{{Message: "file must contain a single policy document"}}
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, []Problem{{Line: doc.Line, Message: "file is empty"}}
+	}
+
+	v := new(validator)
+	v.node(doc.Content[0], reflect.TypeOf(Policy{}), "", fieldRule{})
+	if len(v.problems) > 0 {
+		return nil, v.problems
+	}
+
+	p := new(Policy)
+	if err := doc.Decode(p); err != nil {
+		return nil, []Problem{yamlProblem(err)}
+	}
+
+	return p, nil
+}
+
+// Turn a yaml error into a problem
+func yamlProblem(err error) Problem {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+
+	m := errLine.FindStringSubmatchIndex(msg)
+	if m == nil {
+		return Problem{Message: msg}
+	}
+
+	line, _ := strconv.Atoi(msg[m[2]:m[3]])
+
+	return Problem{
+		Line:    line,
+		Message: strings.TrimSpace(strings.TrimPrefix(msg[m[1]:], ":")),
+	}
+}
+
+// Walks the yaml nodes alongside the policy types
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) add(n *yamlv3.Node, field, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{
+		Line:    n.Line,
+		Column:  n.Column,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate a node against a type and the rule of its field
+func (v *validator) node(n *yamlv3.Node, t reflect.Type, field string, rule fieldRule) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if n.Kind == yamlv3.AliasNode {
+		n = n.Alias
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		v.mapping(n, t, field)
+	case reflect.Slice:
+		v.sequence(n, t, field, rule)
+	case reflect.String:
+		if n.Kind != yamlv3.ScalarNode {
+			v.add(n, field, "must be a string")
+			return
+		}
+
+		v.scalar(n, field, rule)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if n.Kind != yamlv3.ScalarNode || n.ShortTag() != "!!int" {
+			v.add(n, field, "must be an integer")
+			return
+		}
+
+		v.scalar(n, field, rule)
+
+		i, _ := strconv.ParseInt(n.Value, 0, 64)
+		if rule.Minimum != nil && i < *rule.Minimum {
+			v.add(n, field, "must be at least %d", *rule.Minimum)
+		}
+
+		if rule.Maximum != nil && i > *rule.Maximum {
+			v.add(n, field, "must be at most %d", *rule.Maximum)
+		}
+	}
+}
+
+// Fields whose key was renamed, by struct and old key
+var renamedFields = map[string]string{
+	"Schedule.Tag": "TagsToAdd",
+}
+
+func (v *validator) mapping(n *yamlv3.Node, t reflect.Type, field string) {
+	if n.Kind != yamlv3.MappingNode {
+		v.add(n, field, "must be a mapping")
+		return
+	}
+
+	// Fields by yaml key
+	fields := make(map[string]reflect.StructField)
+	var order []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := yamlName(t.Field(i))
+		if name != "" {
+			fields[name] = t.Field(i)
+			order = append(order, name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		path := joinField(field, key.Value)
+
+		f, ok := fields[key.Value]
+		if r, renamed := renamedFields[t.Name()+"."+key.Value]; !ok && renamed {
+			v.add(key, path, "was renamed to %s", r)
+			continue
+		} else if !ok {
+			v.add(key, path, "unknown field")
+			continue
+		}
+
+		if seen[key.Value] {
+			v.add(key, path, "duplicated field")
+			continue
+		}
+		seen[key.Value] = true
+
+		v.node(value, f.Type, path, fieldRules[t.Name()+"."+key.Value])
+	}
+
+	for _, name := range order {
+		if _, omitempty := yamlName(fields[name]); !omitempty && !seen[name] {
+			v.add(n, joinField(field, name), "required field is missing")
+		}
+	}
+}
+
+func (v *validator) sequence(n *yamlv3.Node, t reflect.Type, field string, rule fieldRule) {
+	if n.Kind != yamlv3.SequenceNode {
+		v.add(n, field, "must be a list")
+		return
+	}
+
+	if rule.MinItems != nil && len(n.Content) < *rule.MinItems {
+		v.add(n, field, "must have at least %d item(s)", *rule.MinItems)
+	}
+
+	if rule.MaxItems != nil && len(n.Content) > *rule.MaxItems {
+		v.add(n, field, "must have at most %d item(s)", *rule.MaxItems)
+	}
+
+	for i, c := range n.Content {
+		v.node(c, t.Elem(), fmt.Sprintf("%s[%d]", field, i), fieldRule{Pattern: rule.ItemPattern})
+	}
+}
+
+// Checks shared by strings and integers
+func (v *validator) scalar(n *yamlv3.Node, field string, rule fieldRule) {
+	if len(rule.Enum) > 0 {
+		found := false
+		var allowed []string
+		for _, e := range rule.Enum {
+			allowed = append(allowed, fmt.Sprint(e))
+			if fmt.Sprint(e) == n.Value {
+				found = true
+			}
+		}
+
+		if !found {
+			v.add(n, field, "must be one of %s, got %q", strings.Join(allowed, ", "), n.Value)
+		}
+	}
+
+	if rule.MaxLength != nil && len(n.Value) > *rule.MaxLength {
+		v.add(n, field, "must be at most %d characters long", *rule.MaxLength)
+	}
+
+	if rule.Pattern != "" && !regexp.MustCompile(rule.Pattern).MatchString(n.Value) {
+		v.add(n, field, "%q doesn't match %s", n.Value, rule.Pattern)
+	}
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
@@ -0,0 +1,97 @@
+package file
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+const invalid = `State: PAUSED
+ExecutionRoleArn: arn:aws:iam::123456789101:role/AWSDataLifecycleManagerDefaultRole
+PolicyDetails:
+  ResourceTypes: VOLUME
+  TargetTags: []
+  Schedules:
+  - Name: Daily
+    Colour: blue
+    CreateRule:
+      Interval: twelve
+      IntervalUnit: HOURS
+      Times: ["25:00"]
+    RetainRule:
+      Count: 1001
+`
+
+func TestValidateExample(t *testing.T) {
+	for _, f := range []string{test.SrcTestFile, "../../examples/example.yaml"} {
+		src, err := ioutil.ReadFile(f)
+		assert.NoError(t, err)
+
+		p, problems := Validate(src)
+		assert.Empty(t, problems, f)
+		assert.NotNil(t, p, f)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	p, problems := Validate([]byte(invalid))
+	assert.Nil(t, p)
+
+	lines := make(map[string]int)
+	for _, pr := range problems {
+		lines[pr.Field] = pr.Line
+	}
+
+	assert.Equal(t, map[string]int{
+		"State":                             1,
+		"PolicyDetails.TargetTags":          5,
+		"PolicyDetails.Schedules[0].Colour": 8,
+		"PolicyDetails.Schedules[0].CreateRule.Interval": 10,
+		"PolicyDetails.Schedules[0].CreateRule.Times[0]": 12,
+		"PolicyDetails.Schedules[0].RetainRule.Count":    14,
+	}, lines)
+}
+
+func TestValidateRenamedField(t *testing.T) {
+	src, err := ioutil.ReadFile(test.SrcTestFile)
+	assert.NoError(t, err)
+
+	_, problems := Validate(bytes.Replace(src, []byte("TagsToAdd:"), []byte("Tag:"), 1))
+	if assert.Len(t, problems, 1) {
+		assert.Equal(t, "PolicyDetails.Schedules[0].Tag", problems[0].Field)
+		assert.Equal(t, "was renamed to TagsToAdd", problems[0].Message)
+	}
+}
+
+func TestValidateMissingField(t *testing.T) {
+	_, problems := Validate([]byte("State: ENABLED\n"))
+
+	var fields []string
+	for _, pr := range problems {
+		fields = append(fields, pr.Field)
+	}
+
+	assert.ElementsMatch(t, []string{"ExecutionRoleArn", "PolicyDetails"}, fields)
+}
+
+func TestValidateSyntaxError(t *testing.T) {
+	_, problems := Validate([]byte("State: ENABLED\nPolicyDetails: [\n"))
+	if assert.Len(t, problems, 1) {
+		assert.NotZero(t, problems[0].Line)
+	}
+
+	_, problems = Validate([]byte(""))
+	assert.Len(t, problems, 1)
+
+	_, problems = Validate([]byte("State: ENABLED\n---\nState: DISABLED\n"))
+	assert.Len(t, problems, 1)
+}
+
+func TestProblemString(t *testing.T) {
+	assert.Equal(t, "line 3: State: must be set", Problem{Line: 3, Field: "State", Message: "must be set"}.String())
+	assert.Equal(t, "file is empty", Problem{Message: "file is empty"}.String())
+}
@@ -0,0 +1,191 @@
+// Package local provides stand-ins of the AWS services
+// so the processors can run on a laptop, e.g. to replay
+// the events of a failed invocation.
+package local
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dlm"
+	"github.com/aws/aws-sdk-go/service/dlm/dlmiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+)
+
+// Downloader serving the objects of every bucket
+// from a local directory, keys being relative paths
+type Downloader struct {
+	s3manageriface.DownloaderAPI
+	Dir string
+}
+
+func (d Downloader) Download(w io.WriterAt, input *s3.GetObjectInput, options ...func(*s3manager.Downloader)) (int64, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(d.Dir, filepath.FromSlash(aws.StringValue(input.Key))))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", err)
+		}
+
+		return 0, err
+	}
+
+	n, err := w.WriteAt(raw, 0)
+	return int64(n), err
+}
+
+// In memory DLM
+type Dlm struct {
+	dlmiface.DLMAPI
+	mu       sync.Mutex
+	seq      int
+	policies map[string]*dlm.LifecyclePolicy
+}
+
+// New in memory DLM. The given policy ids exist
+// with empty policies, e.g. those of the registry.
+func NewDlm(ids ...string) *Dlm {
+	d := &Dlm{policies: make(map[string]*dlm.LifecyclePolicy)}
+	for _, id := range ids {
+		d.policies[id] = &dlm.LifecyclePolicy{PolicyId: aws.String(id)}
+	}
+
+	return d
+}
+
+func (d *Dlm) CreateLifecyclePolicy(i *dlm.CreateLifecyclePolicyInput) (*dlm.CreateLifecyclePolicyOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.seq++
+	id := fmt.Sprintf("policy-local-%d", d.seq)
+	now := time.Now()
+
+	d.policies[id] = &dlm.LifecyclePolicy{
+		DateCreated:      &now,
+		DateModified:     &now,
+		Description:      i.Description,
+		ExecutionRoleArn: i.ExecutionRoleArn,
+		PolicyDetails:    i.PolicyDetails,
+		PolicyId:         aws.String(id),
+		State:            i.State,
+		Tags:             i.Tags,
+	}
+
+	return &dlm.CreateLifecyclePolicyOutput{PolicyId: aws.String(id)}, nil
+}
+
+func (d *Dlm) UpdateLifecyclePolicy(i *dlm.UpdateLifecyclePolicyInput) (*dlm.UpdateLifecyclePolicyOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lp, ok := d.policies[aws.StringValue(i.PolicyId)]
+	if !ok {
+		return nil, notFound(i.PolicyId)
+	}
+
+	now := time.Now()
+	lp.DateModified = &now
+	lp.Description = i.Description
+	lp.ExecutionRoleArn = i.ExecutionRoleArn
+	lp.PolicyDetails = i.PolicyDetails
+	lp.State = i.State
+
+	return &dlm.UpdateLifecyclePolicyOutput{}, nil
+}
+
+func (d *Dlm) DeleteLifecyclePolicy(i *dlm.DeleteLifecyclePolicyInput) (*dlm.DeleteLifecyclePolicyOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.policies[aws.StringValue(i.PolicyId)]; !ok {
+		return nil, notFound(i.PolicyId)
+	}
+
+	delete(d.policies, aws.StringValue(i.PolicyId))
+
+	return &dlm.DeleteLifecyclePolicyOutput{}, nil
+}
+
+func (d *Dlm) GetLifecyclePolicy(i *dlm.GetLifecyclePolicyInput) (*dlm.GetLifecyclePolicyOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lp, ok := d.policies[aws.StringValue(i.PolicyId)]
+	if !ok {
+		return nil, notFound(i.PolicyId)
+	}
+
+	return &dlm.GetLifecyclePolicyOutput{Policy: lp}, nil
+}
+
+// Supports the policy id and target tag filters
+func (d *Dlm) GetLifecyclePolicies(i *dlm.GetLifecyclePoliciesInput) (*dlm.GetLifecyclePoliciesOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var ids []string
+	for id, lp := range d.policies {
+		if len(i.PolicyIds) > 0 && !contains(aws.StringValueSlice(i.PolicyIds), id) {
+			continue
+		}
+
+		if len(i.TargetTags) > 0 && !targets(lp, aws.StringValueSlice(i.TargetTags)) {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	output := new(dlm.GetLifecyclePoliciesOutput)
+	for _, id := range ids {
+		lp := d.policies[id]
+		output.Policies = append(output.Policies, &dlm.LifecyclePolicySummary{
+			Description: lp.Description,
+			PolicyId:    lp.PolicyId,
+			State:       lp.State,
+			Tags:        lp.Tags,
+		})
+	}
+
+	return output, nil
+}
+
+// If the policy targets any of the key=value tags
+func targets(lp *dlm.LifecyclePolicy, tags []string) bool {
+	if lp.PolicyDetails == nil {
+		return false
+	}
+
+	for _, t := range lp.PolicyDetails.TargetTags {
+		if contains(tags, fmt.Sprintf("%s=%s", aws.StringValue(t.Key), aws.StringValue(t.Value))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func notFound(id *string) error {
+	return awserr.New(dlm.ErrCodeResourceNotFoundException, fmt.Sprintf("Policy %s doesn't exist", aws.StringValue(id)), nil)
+}
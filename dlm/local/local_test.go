@@ -0,0 +1,57 @@
+package local
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dlm"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloader(t *testing.T) {
+	d := Downloader{Dir: "../../testdata"}
+
+	buf := aws.NewWriteAtBuffer([]byte{})
+	n, err := d.Download(buf, &s3.GetObjectInput{Bucket: aws.String("any"), Key: aws.String("policy_example.yaml")})
+	assert.NoError(t, err)
+	assert.True(t, n > 0)
+
+	_, err = d.Download(buf, &s3.GetObjectInput{Key: aws.String("_guardrails.yaml")})
+	aerr, ok := err.(awserr.Error)
+	assert.True(t, ok)
+	assert.Equal(t, s3.ErrCodeNoSuchKey, aerr.Code())
+}
+
+func TestDlm(t *testing.T) {
+	d := NewDlm("existing-id")
+
+	output, err := d.CreateLifecyclePolicy(&dlm.CreateLifecyclePolicyInput{
+		State: aws.String("ENABLED"),
+		PolicyDetails: &dlm.PolicyDetails{
+			TargetTags: []*dlm.Tag{{Key: aws.String("Name"), Value: aws.String("app")}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "policy-local-1", aws.StringValue(output.PolicyId))
+
+	list, err := d.GetLifecyclePolicies(&dlm.GetLifecyclePoliciesInput{TargetTags: aws.StringSlice([]string{"Name=app"})})
+	assert.NoError(t, err)
+	assert.Len(t, list.Policies, 1)
+
+	_, err = d.UpdateLifecyclePolicy(&dlm.UpdateLifecyclePolicyInput{PolicyId: aws.String("existing-id"), State: aws.String("DISABLED")})
+	assert.NoError(t, err)
+
+	got, err := d.GetLifecyclePolicy(&dlm.GetLifecyclePolicyInput{PolicyId: aws.String("existing-id")})
+	assert.NoError(t, err)
+	assert.Equal(t, "DISABLED", aws.StringValue(got.Policy.State))
+
+	_, err = d.DeleteLifecyclePolicy(&dlm.DeleteLifecyclePolicyInput{PolicyId: aws.String("existing-id")})
+	assert.NoError(t, err)
+
+	_, err = d.UpdateLifecyclePolicy(&dlm.UpdateLifecyclePolicyInput{PolicyId: aws.String("existing-id")})
+	aerr, ok := err.(awserr.Error)
+	assert.True(t, ok)
+	assert.Equal(t, dlm.ErrCodeResourceNotFoundException, aerr.Code())
+}
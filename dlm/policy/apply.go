@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+)
+
+// Event names of the synthetic records
+const (
+	eventCreated = "ObjectCreated:Put"
+	eventRemoved = "ObjectRemoved:Delete"
+)
+
+// Apply makes the planned changes outside of lambda.
+// Every change is turned into the S3 event record the
+// upload or removal would have triggered and dispatched
+// to the same processors as the handler. The policy files
+// come with the changes so nothing is downloaded. The
+// bucket is only used to load the guardrails and rules
+// from, unless they are configured. Without either
+// they are skipped. Records of
+// applied files are local, so reconciling the bucket
+// leaves them alone.
+func (p *Policy) Apply(changes []*Change, bucket string, c lambdacontext.LambdaContext) error {
+	errCount := 0
+	for _, change := range changes {
+		if change.Action == ActionNoOp || change.Action == ActionInvalid {
+			continue
+		}
+
+		if err := p.applyChange(change, bucket, c); err != nil {
+			errCount++
+			log.Println(fmt.Sprintf("%s Failed to %s %s: %v", errorPrefix, change.Action, change.Key, err))
+			continue
+		}
+
+		log.Println(fmt.Sprintf("%s Successfully applied %s of %s", msgPrefix, change.Action, change.Key))
+	}
+
+	if errCount > 0 {
+		return fmt.Errorf("Failed to apply %d change(s)", errCount)
+	}
+
+	return nil
+}
+
+// Dispatch a change as an event record
+func (p *Policy) applyChange(change *Change, bucket string, c lambdacontext.LambdaContext) error {
+	record := events.S3EventRecord{
+		EventName: eventCreated,
+		EventTime: time.Now().UTC(),
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: bucket},
+			Object: events.S3Object{Key: change.Key, VersionID: change.rollbackVersion},
+		},
+	}
+
+	if change.Action == ActionDelete {
+		record.EventName = eventRemoved
+	}
+
+	if err := p.SetPolicy(record, c); err != nil {
+		return err
+	}
+
+	// Planned changes were compared with DLM already
+	p.item.source = change.source
+	p.item.rollbackVersion = change.rollbackVersion
+	p.item.force = true
+	p.item.origin = db.OriginLocal
+
+	return p.execute()
+}
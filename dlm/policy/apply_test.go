@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+func TestApply(t *testing.T) {
+	conn := db.NewMemory(&db.Item{S3ObjectKey: "policies/gone.yaml", PolicyId: "gone-id", Hash: "gone"})
+
+	p, sources := GetPlanner(nil)
+	p.SetDBConn(conn)
+
+	changes, err := p.Plan(sources, "policies/")
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+
+	err = p.Apply(changes, "", lambdacontext.LambdaContext{AwsRequestID: "apply-1"})
+	assert.NoError(t, err)
+
+	items, err := conn.All()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "policies/"+test.PolicyExampleFileName, items[0].S3ObjectKey)
+	assert.Equal(t, "test-id", items[0].PolicyId)
+	assert.Equal(t, "apply-1", items[0].RequestId)
+	assert.True(t, items[0].IsLocal())
+}
+
+func TestApplyFailure(t *testing.T) {
+	p, sources := GetPlanner(nil)
+
+	changes, err := p.Plan(sources, "policies/")
+	assert.NoError(t, err)
+
+	p.SetClients(&AwsClients{Dlm: &test.MockDlm{Err: assert.AnError}})
+	p.SetDBConn(db.NewMemory())
+
+	err = p.Apply(changes, "", lambdacontext.LambdaContext{})
+	assert.EqualError(t, err, "Failed to apply 1 change(s)")
+}
+
+func TestApplyConfiguredGuardrails(t *testing.T) {
+	p, sources := GetPlanner(nil)
+
+	changes, err := p.Plan(sources, "policies/")
+	assert.NoError(t, err)
+
+	// Checked without a bucket
+	c := DefaultConfig()
+	c.Guardrails, err = ParseGuardrails([]byte("MinRetention: 14"))
+	assert.NoError(t, err)
+	p.SetConfig(c)
+
+	err = p.Apply(changes, "", lambdacontext.LambdaContext{})
+	assert.EqualError(t, err, "Failed to apply 1 change(s)")
+}
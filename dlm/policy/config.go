@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables configuring the processors
+const (
+	EnvTagConflict  = "ADLM_TAG_CONFLICT"
+	EnvDebug        = "ADLM_DEBUG"
+	EnvBucket       = "ADLM_BUCKET"
+	EnvMaxChanges   = "ADLM_RECONCILE_MAX_CHANGES"
+	EnvDriftAction  = "ADLM_DRIFT_ACTION"
+	EnvDriftTopic   = "ADLM_DRIFT_TOPIC"
+	EnvOrphanAction = "ADLM_ORPHAN_ACTION"
+)
+
+// What to do when a live policy drifted from its file
+const (
+	DriftAlert   = "alert"
+	DriftReapply = "reapply"
+)
+
+// What to do with DLM policies created by adlm-helper
+// that have no registry record
+const (
+	OrphanAdopt  = "adopt"
+	OrphanDelete = "delete"
+)
+
+// Suffix of the policy bucket created by the
+// SAM stack, "<account id>-adlm-helper"
+const PolicyBucketSuffix = "-adlm-helper"
+
+// Changes a reconciliation run makes at most by default
+const DefaultMaxChanges = 10
+
+// How to react when a policy targets a tag that
+// another managed policy already targets
+const (
+	ConflictReject = "reject"
+	ConflictWarn   = "warn"
+	ConflictIgnore = "ignore"
+)
+
+// Processors configuration
+type Config struct {
+	// Reaction to conflicting target tags
+	TagConflict string
+
+	// Log the inputs sent to DLM
+	Debug bool
+
+	// Policy bucket, reconciled on schedule
+	Bucket string
+
+	// Changes a reconciliation run makes at most.
+	// Runs planning more changes make none.
+	MaxChanges int
+
+	// Response to drift
+	DriftAction string
+
+	// SNS topic to alert drift to, if any
+	DriftTopic string
+
+	// Response to orphaned policies
+	OrphanAction string
+
+	// Guardrails and rules used instead of those of the
+	// event's bucket, e.g. read from local files
+	Guardrails *Guardrails
+	Rules      *RuleSet
+}
+
+// Configuration used when nothing is set
+func DefaultConfig() *Config {
+	return &Config{
+		TagConflict:  ConflictReject,
+		MaxChanges:   DefaultMaxChanges,
+		DriftAction:  DriftAlert,
+		OrphanAction: OrphanAdopt,
+	}
+}
+
+// Load configuration from environment variables.
+// Unset variables keep their default value.
+func ConfigFromEnv() (*Config, error) {
+	c := DefaultConfig()
+
+	if v := os.Getenv(EnvTagConflict); v != "" {
+		c.TagConflict = v
+	}
+
+	if v := os.Getenv(EnvDebug); v != "" {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value %q. Must be true or false", EnvDebug, v)
+		}
+
+		c.Debug = debug
+	}
+
+	c.Bucket = os.Getenv(EnvBucket)
+	c.DriftTopic = os.Getenv(EnvDriftTopic)
+
+	if v := os.Getenv(EnvDriftAction); v != "" {
+		c.DriftAction = v
+	}
+
+	if v := os.Getenv(EnvOrphanAction); v != "" {
+		c.OrphanAction = v
+	}
+
+	if v := os.Getenv(EnvMaxChanges); v != "" {
+		max, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value %q. Must be a number", EnvMaxChanges, v)
+		}
+
+		c.MaxChanges = max
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// If the bucket is a policy bucket. Objects written
+// to it trigger the function.
+func (c *Config) IsPolicyBucket(bucket string) bool {
+	return bucket != "" && (bucket == c.Bucket || strings.HasSuffix(bucket, PolicyBucketSuffix))
+}
+
+// Check configuration values
+func (c *Config) Validate() error {
+	switch c.TagConflict {
+	case ConflictReject, ConflictWarn, ConflictIgnore:
+	default:
+		return fmt.Errorf("Invalid %s value %q. Must be one of %s, %s or %s", EnvTagConflict, c.TagConflict, ConflictReject, ConflictWarn, ConflictIgnore)
+	}
+
+	switch c.DriftAction {
+	case DriftAlert, DriftReapply:
+	default:
+		return fmt.Errorf("Invalid %s value %q. Must be %s or %s", EnvDriftAction, c.DriftAction, DriftAlert, DriftReapply)
+	}
+
+	switch c.OrphanAction {
+	case OrphanAdopt, OrphanDelete:
+	default:
+		return fmt.Errorf("Invalid %s value %q. Must be %s or %s", EnvOrphanAction, c.OrphanAction, OrphanAdopt, OrphanDelete)
+	}
+
+	if c.MaxChanges < 0 {
+		return fmt.Errorf("Invalid %s value %d. Must not be negative", EnvMaxChanges, c.MaxChanges)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+)
+
+// Check the target tags against every other policy
+// managed by adlm-helper, including the ones of pending
+// creates. DLM would otherwise snapshot the same volume
+// once per policy.
+func (u Upserter) checkTagConflicts(tags []*dlm.Tag) error {
+	if u.config.TagConflict == ConflictIgnore {
+		return nil
+	}
+
+	items, err := u.dbconn.All()
+	if err != nil {
+		return err
+	}
+
+	// Other managed policies indexed by policy id
+	managed := make(map[string]*db.Item)
+	for _, i := range items {
+		if i.S3ObjectKey == u.item.record.S3.Object.Key {
+			continue
+		}
+
+		if u.item.dbItem != nil && i.PolicyId == u.item.dbItem.PolicyId {
+			continue
+		}
+
+		managed[i.PolicyId] = i
+	}
+
+	// Pending creates of other files, indexed by client
+	// token. Their policy may exist without a record yet.
+	pending, err := u.dbconn.Pending()
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[string]*db.Item)
+	for _, i := range pending {
+		if i.S3ObjectKey != u.item.record.S3.Object.Key {
+			tokens[i.ClientToken] = i
+		}
+	}
+
+	if len(managed) == 0 && len(tokens) == 0 {
+		return nil
+	}
+
+	var conflicts []string
+	for _, t := range tags {
+		tag := fmt.Sprintf("%s=%s", aws.StringValue(t.Key), aws.StringValue(t.Value))
+
+		output, err := u.client.Dlm.GetLifecyclePolicies(&dlm.GetLifecyclePoliciesInput{
+			TargetTags: []*string{aws.String(tag)},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, s := range output.Policies {
+			if i, ok := managed[aws.StringValue(s.PolicyId)]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%s is also targeted by %s (%s)", tag, i.S3ObjectKey, i.PolicyId))
+			} else if i, ok := tokens[aws.StringValue(s.Tags[TagToken])]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%s is also targeted by %s (%s, pending)", tag, i.S3ObjectKey, aws.StringValue(s.PolicyId)))
+			}
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("Policy %s has conflicting target tags: %s", u.item.record.S3.Object.Key, strings.Join(conflicts, "; "))
+	if u.config.TagConflict == ConflictWarn {
+		log.Println(fmt.Sprintf("%s %s", warnPrefix, msg))
+		return nil
+	}
+
+	return errors.New(msg)
+}
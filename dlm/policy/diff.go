@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Difference of a single field
+type FieldDiff struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// Field value pair in the order it was found
+type fieldValue struct {
+	field string
+	value interface{}
+}
+
+// List indices in a field path
+var fieldIndex = regexp.MustCompile(`\[\d+\]`)
+
+// Diff compares two values field by field.
+// Fields are named after the struct fields with
+// list indices, e.g. PolicyDetails.TargetTags[0].Key.
+// Nil and missing fields are equal.
+func Diff(old, new interface{}) []FieldDiff {
+	var oldFields, newFields []fieldValue
+	flatten("", reflect.ValueOf(old), &oldFields)
+	flatten("", reflect.ValueOf(new), &newFields)
+
+	oldValues := make(map[string]interface{})
+	for _, f := range oldFields {
+		oldValues[f.field] = f.value
+	}
+
+	var diffs []FieldDiff
+	seen := make(map[string]bool)
+	for _, f := range newFields {
+		seen[f.field] = true
+		if o, ok := oldValues[f.field]; !ok || !reflect.DeepEqual(o, f.value) {
+			diffs = append(diffs, FieldDiff{Field: f.field, Old: o, New: f.value})
+		}
+	}
+
+	for _, f := range oldFields {
+		if !seen[f.field] {
+			diffs = append(diffs, FieldDiff{Field: f.field, Old: f.value})
+		}
+	}
+
+	return diffs
+}
+
+// Keep the diffs of the given fields and their children.
+// List indices are ignored when matching.
+func filterDiffs(diffs []FieldDiff, fields []string) []FieldDiff {
+	var kept []FieldDiff
+	for _, d := range diffs {
+		name := fieldIndex.ReplaceAllString(d.Field, "[]")
+		for _, f := range fields {
+			if name == f || strings.HasPrefix(name, f+".") || strings.HasPrefix(name, f+"[") {
+				kept = append(kept, d)
+				break
+			}
+		}
+	}
+
+	return kept
+}
+
+// Collect the scalar leaves of a value
+func flatten(prefix string, v reflect.Value, out *[]fieldValue) {
+	if !v.IsValid() {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+
+		if t, ok := v.Interface().(*time.Time); ok {
+			*out = append(*out, fieldValue{prefix, t.UTC().Format(time.RFC3339)})
+			return
+		}
+
+		flatten(prefix, v.Elem(), out)
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			*out = append(*out, fieldValue{prefix, t.UTC().Format(time.RFC3339)})
+			return
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+
+			flatten(joinPath(prefix, f.Name), v.Field(i), out)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), v.Index(i), out)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(a, b int) bool {
+			return fmt.Sprint(keys[a].Interface()) < fmt.Sprint(keys[b].Interface())
+		})
+
+		for _, k := range keys {
+			flatten(joinPath(prefix, fmt.Sprint(k.Interface())), v.MapIndex(k), out)
+		}
+	default:
+		*out = append(*out, fieldValue{prefix, v.Interface()})
+	}
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
+
+// Render a value of a diff
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(raw)
+}
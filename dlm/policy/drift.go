@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sns"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Live policy differing from its file
+type Drift struct {
+	Key      string      `json:"key"`
+	PolicyId string      `json:"policyId"`
+	Diffs    []FieldDiff `json:"diffs,omitempty"`
+	Missing  bool        `json:"missing,omitempty"`
+
+	// Update bringing the policy back to its file
+	change *Change
+}
+
+func (d *Drift) String() string {
+	if d.Missing {
+		return fmt.Sprintf("Policy %s of %s no longer exists in DLM", d.PolicyId, d.Key)
+	}
+
+	return fmt.Sprintf("Policy %s of %s drifted in %d field(s)", d.PolicyId, d.Key, len(d.Diffs))
+}
+
+// Drift found in an update change, nil if there is none.
+// Updates of files changed since they were last applied
+// aren't drift, they are missed updates.
+func driftOf(c *Change) *Drift {
+	if c.Action != ActionUpdate || c.missed {
+		return nil
+	}
+
+	return &Drift{
+		Key:      c.Key,
+		PolicyId: c.PolicyId,
+		Diffs:    c.Diffs,
+		Missing:  c.missing,
+		change:   c,
+	}
+}
+
+// DriftDetector compares the live policies in DLM with
+// the inputs hydrated from their files in the bucket.
+// Only the fields a file can set are compared. Drift is
+// either alerted, or the files are applied again.
+type DriftDetector struct {
+	policy *Policy
+	bucket string
+}
+
+// Drift detector of the managed policies of a bucket
+func NewDriftDetector(p *Policy, bucket string) *DriftDetector {
+	if p.config == nil {
+		p.config = DefaultConfig()
+	}
+
+	return &DriftDetector{policy: p, bucket: bucket}
+}
+
+// Detect drift of every registry record. Records
+// whose object is gone, isn't a valid policy file or
+// changed since it was applied are left to reconciliation. Files rolled back to
+// a version are compared with that version.
+func (d *DriftDetector) Detect() ([]*Drift, error) {
+	items, err := d.policy.dbconn.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []*Drift
+	for _, i := range items {
+		drift, err := d.detect(i)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to detect drift of %s: %v", i.S3ObjectKey, err)
+		}
+
+		if drift != nil {
+			drifts = append(drifts, drift)
+		}
+	}
+
+	return drifts, nil
+}
+
+func (d *DriftDetector) detect(i *db.Item) (*Drift, error) {
+	raw, err := file.DownloadVersion(d.bucket, i.S3ObjectKey, i.RollbackVersion, d.policy.client.S3Downloader)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	f, err := file.Parse(raw)
+	if err != nil {
+		log.Println(fmt.Sprintf("%s Skipping %s, it isn't a valid policy file: %v", warnPrefix, i.S3ObjectKey, err))
+		return nil, nil
+	}
+
+	c, err := d.policy.planSource(&Source{Key: i.S3ObjectKey, Policy: f, RollbackVersion: i.RollbackVersion}, i)
+	if err != nil {
+		return nil, err
+	}
+
+	return driftOf(c), nil
+}
+
+// Respond to drift as configured. Alerts are logged and
+// published to the drift topic if there is one.
+func (d *DriftDetector) Respond(drifts []*Drift, c lambdacontext.LambdaContext) error {
+	if len(drifts) == 0 {
+		return nil
+	}
+
+	for _, drift := range drifts {
+		log.Println(fmt.Sprintf("%s %s", warnPrefix, drift))
+	}
+
+	if d.policy.config.DriftAction == DriftReapply {
+		failed := 0
+		for _, drift := range drifts {
+			if err := d.policy.applyChange(drift.change, d.bucket, c); err != nil {
+				failed++
+				log.Println(fmt.Sprintf("%s Failed to reapply %s: %v", errorPrefix, drift.Key, err))
+				continue
+			}
+
+			log.Println(fmt.Sprintf("%s Reapplied %s to policy %s", msgPrefix, drift.Key, drift.PolicyId))
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("Failed to reapply %d drifted policy(ies)", failed)
+		}
+
+		return nil
+	}
+
+	return d.alert(drifts)
+}
+
+// Detect drift and respond to it
+func (d *DriftDetector) Run(c lambdacontext.LambdaContext) ([]*Drift, error) {
+	drifts, err := d.Detect()
+	if err != nil {
+		return nil, err
+	}
+
+	return drifts, d.Respond(drifts, c)
+}
+
+// Publish drift to the topic
+func (d *DriftDetector) alert(drifts []*Drift) error {
+	if d.policy.config.DriftTopic == "" || d.policy.client.Sns == nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	for _, drift := range drifts {
+		fmt.Fprintln(&b, drift)
+		WriteDiffs(&b, drift.Diffs, "    ")
+	}
+
+	_, err := d.policy.client.Sns.Publish(&sns.PublishInput{
+		TopicArn: aws.String(d.policy.config.DriftTopic),
+		Subject:  aws.String(fmt.Sprintf("adlm-helper: %d policy(ies) drifted", len(drifts))),
+		Message:  aws.String(b.String()),
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to publish drift to %s: %v", d.policy.config.DriftTopic, err)
+	}
+
+	return nil
+}
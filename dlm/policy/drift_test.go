@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Policy facade where the live policy of a.yaml was
+// changed in the console as given by the DLM payload
+func GetDriftingPolicy(action string, dlmPayload map[string]string) (*Policy, *test.MockSns) {
+	topic := new(test.MockSns)
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: &test.MockDownloader{Objects: map[string]string{}},
+		Dlm:          &test.MockDlm{Payload: dlmPayload},
+		Sns:          topic,
+	})
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "a.yaml", PolicyId: "a-id"}))
+	p.SetConfig(&Config{TagConflict: ConflictReject, DriftAction: action, DriftTopic: "arn:aws:sns:ap-southeast-2:123456789101:drift"})
+
+	return p, topic
+}
+
+func TestDetectDrift(t *testing.T) {
+	p, _ := GetDriftingPolicy(DriftAlert, map[string]string{"state": "DISABLED"})
+
+	drifts, err := NewDriftDetector(p, "dummy-bucket").Detect()
+	assert.NoError(t, err)
+	assert.Len(t, drifts, 1)
+	assert.Equal(t, "a.yaml", drifts[0].Key)
+	assert.Equal(t, []FieldDiff{{Field: "State", Old: "DISABLED", New: "ENABLED"}}, drifts[0].Diffs)
+}
+
+func TestDetectNoDrift(t *testing.T) {
+	p, _ := GetDriftingPolicy(DriftAlert, nil)
+
+	drifts, err := NewDriftDetector(p, "dummy-bucket").Detect()
+	assert.NoError(t, err)
+	assert.Empty(t, drifts)
+}
+
+func TestDetectNoDriftRollback(t *testing.T) {
+	raw, err := ioutil.ReadFile(test.SrcTestFile)
+	assert.NoError(t, err)
+
+	// Rolled back to a disabled version
+	p, _ := GetDriftingPolicy(DriftAlert, map[string]string{"state": "DISABLED"})
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "a.yaml", PolicyId: "a-id", RollbackVersion: "v1"}))
+	p.client.S3Downloader = &test.MockDownloader{Objects: map[string]string{
+		"a.yaml?versionId=v1": strings.Replace(string(raw), "State: ENABLED", "State: DISABLED", 1),
+	}}
+
+	drifts, err := NewDriftDetector(p, "dummy-bucket").Detect()
+	assert.NoError(t, err)
+	assert.Empty(t, drifts)
+}
+
+func TestDriftAlert(t *testing.T) {
+	p, topic := GetDriftingPolicy(DriftAlert, map[string]string{"missing": "yes"})
+
+	drifts, err := NewDriftDetector(p, "dummy-bucket").Run(lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.True(t, drifts[0].Missing)
+	assert.Len(t, topic.Messages, 1)
+	assert.Contains(t, topic.Messages[0], "Policy a-id of a.yaml no longer exists in DLM")
+}
+
+func TestDriftReapply(t *testing.T) {
+	p, topic := GetDriftingPolicy(DriftReapply, map[string]string{"state": "DISABLED"})
+
+	drifts, err := NewDriftDetector(p, "dummy-bucket").Run(lambdacontext.LambdaContext{AwsRequestID: "drift-1"})
+	assert.NoError(t, err)
+	assert.Len(t, drifts, 1)
+	assert.Empty(t, topic.Messages)
+
+	di, err := p.dbconn.FindByKey("a.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "drift-1", di.RequestId)
+}
+
+func TestReconcileDriftAlert(t *testing.T) {
+	raw, err := ioutil.ReadFile(test.SrcTestFile)
+	assert.NoError(t, err)
+	f, err := file.Parse(raw)
+	assert.NoError(t, err)
+	input, err := NewUpdateInput(f, "a-id")
+	assert.NoError(t, err)
+	hash, err := InputHash(input)
+	assert.NoError(t, err)
+
+	p, topic := GetDriftingPolicy(DriftAlert, map[string]string{"state": "DISABLED"})
+	p.client.S3 = &test.MockS3{Payload: map[string]string{"objects": "a.yaml"}}
+
+	// The file is unchanged since it was applied
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "a.yaml", PolicyId: "a-id", Hash: hash}))
+
+	report, err := p.Reconcile("dummy-bucket", DefaultMaxChanges, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Drifted)
+	assert.Equal(t, 0, report.Updated)
+	assert.Len(t, topic.Messages, 1)
+}
+
+func TestReconcileMissedUpdate(t *testing.T) {
+	p, topic := GetDriftingPolicy(DriftAlert, map[string]string{"state": "DISABLED"})
+	p.client.S3 = &test.MockS3{Payload: map[string]string{"objects": "a.yaml"}}
+
+	// The file changed since it was applied
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "a.yaml", PolicyId: "a-id", Hash: "applied"}))
+
+	report, err := p.Reconcile("dummy-bucket", DefaultMaxChanges, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Drifted)
+	assert.Equal(t, 1, report.Updated)
+	assert.Empty(t, topic.Messages)
+}
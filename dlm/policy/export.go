@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Policy written from its live state
+type Exported struct {
+	PolicyId string `json:"policyId"`
+	Key      string `json:"key"`
+	Missing  bool   `json:"missing,omitempty"`
+}
+
+// Export writes the live state of every managed policy
+// as a policy file, so changes made outside of the files,
+// e.g. in the console, can be diffed against them. Files
+// are written under the prefix with the key of the record.
+// Records whose policy doesn't exist are reported as missing.
+func (p *Policy) Export(w Writer, prefix string) ([]*Exported, error) {
+	items, err := p.dbconn.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var exported []*Exported
+	for _, i := range items {
+		e := &Exported{PolicyId: i.PolicyId, Key: path.Join(prefix, i.S3ObjectKey)}
+
+		lp, err := p.getLivePolicy(i.PolicyId)
+		if err != nil {
+			return exported, fmt.Errorf("Failed to export %s: %v", i.S3ObjectKey, err)
+		}
+
+		if lp == nil {
+			log.Println(fmt.Sprintf("%s Policy %s of %s doesn't exist in DLM", warnPrefix, i.PolicyId, i.S3ObjectKey))
+			e.Missing = true
+			exported = append(exported, e)
+			continue
+		}
+
+		f, err := NewPolicyFile(lp)
+		if err != nil {
+			return exported, fmt.Errorf("Failed to export %s: %v", i.S3ObjectKey, err)
+		}
+
+		raw, err := file.Marshal(f)
+		if err != nil {
+			return exported, fmt.Errorf("Failed to export %s: %v", i.S3ObjectKey, err)
+		}
+
+		if err = w.Write(e.Key, raw); err != nil {
+			return exported, fmt.Errorf("Failed to export %s: %v", i.S3ObjectKey, err)
+		}
+
+		exported = append(exported, e)
+	}
+
+	return exported, nil
+}
@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+func TestExport(t *testing.T) {
+	p := new(Policy)
+	p.SetClients(&AwsClients{Dlm: new(test.MockDlm)})
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "policies/app.yaml", PolicyId: "test-id"}))
+
+	uploader := new(test.MockUploader)
+	exported, err := p.Export(BucketWriter{Bucket: "export-bucket", Uploader: uploader}, "live")
+	assert.NoError(t, err)
+	assert.Equal(t, []*Exported{{PolicyId: "test-id", Key: "live/policies/app.yaml"}}, exported)
+
+	// Same as the source file of the live policy
+	f, err := file.Parse([]byte(uploader.Objects["live/policies/app.yaml"]))
+	assert.NoError(t, err)
+
+	sources, err := LoadLocalSources("../../testdata", "")
+	assert.NoError(t, err)
+	assert.Equal(t, sources[0].Policy, f)
+}
+
+func TestExportMissing(t *testing.T) {
+	p := new(Policy)
+	p.SetClients(&AwsClients{Dlm: &test.MockDlm{Payload: map[string]string{"missing": "yes"}}})
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "policies/app.yaml", PolicyId: "test-id"}))
+
+	uploader := new(test.MockUploader)
+	exported, err := p.Export(BucketWriter{Uploader: uploader}, "")
+	assert.NoError(t, err)
+	assert.True(t, exported[0].Missing)
+	assert.Empty(t, uploader.Objects)
+}
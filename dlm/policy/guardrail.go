@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"gopkg.in/yaml.v2"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Object in the bucket holding the guardrail rules
+const GuardrailsKey = file.GuardrailsName
+
+// Names of the guardrail rules
+const (
+	RuleMinRetention     = "MinRetention"
+	RuleMaxRetention     = "MaxRetention"
+	RuleAllowedRoleArns  = "AllowedRoleArns"
+	RuleRequiredTags     = "RequiredTags"
+	RuleAllowedIntervals = "AllowedIntervals"
+	RuleForbiddenStates  = "ForbiddenStates"
+)
+
+// Organisation wide rules every policy must follow.
+// Rules left empty are not enforced.
+type Guardrails struct {
+	// Bounds of the snapshot retain count
+	MinRetention int64 `yaml:"MinRetention,omitempty"`
+	MaxRetention int64 `yaml:"MaxRetention,omitempty"`
+
+	// Execution roles policies may use. Supports * wildcard
+	AllowedRoleArns []string `yaml:"AllowedRoleArns,omitempty"`
+
+	// Tag keys every schedule must add to its snapshots
+	RequiredTags []string `yaml:"RequiredTags,omitempty"`
+
+	// Snapshot intervals policies may use
+	AllowedIntervals []int64 `yaml:"AllowedIntervals,omitempty"`
+
+	// Policy states that can't be used
+	ForbiddenStates []string `yaml:"ForbiddenStates,omitempty"`
+}
+
+// A guardrail rule broken by a policy
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Error returned when a policy breaks guardrails
+type GuardrailError struct {
+	Key        string
+	Violations []Violation
+}
+
+func (e *GuardrailError) Error() string {
+	var msgs []string
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("guardrail %s: %s", v.Rule, v.Message))
+	}
+
+	return fmt.Sprintf("Policy %s violates %s", e.Key, strings.Join(msgs, "; "))
+}
+
+// Load guardrails from the bucket.
+// It returns nil if the bucket has no guardrails.
+func LoadGuardrails(bucket string, downloader s3manageriface.DownloaderAPI) (*Guardrails, error) {
+	raw, err := file.Download(bucket, GuardrailsKey, downloader)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("Failed to load guardrails from %s/%s: %v", bucket, GuardrailsKey, err)
+	}
+
+	return ParseGuardrails(raw)
+}
+
+// Parse guardrails. Unknown rules are rejected
+// so a typo doesn't silently disable a rule.
+func ParseGuardrails(raw []byte) (*Guardrails, error) {
+	g := new(Guardrails)
+	if err := yaml.UnmarshalStrict(raw, g); err != nil {
+		return nil, fmt.Errorf("Failed to parse guardrails: %v", err)
+	}
+
+	return g, nil
+}
+
+// Evaluate a policy against the guardrails
+func (g *Guardrails) Evaluate(p *file.Policy) []Violation {
+	var vs []Violation
+
+	if len(g.AllowedRoleArns) > 0 && !matchAny(g.AllowedRoleArns, p.ExecutionRoleArn) {
+		vs = append(vs, Violation{RuleAllowedRoleArns, fmt.Sprintf("execution role %s is not approved", p.ExecutionRoleArn)})
+	}
+
+	for _, s := range g.ForbiddenStates {
+		if strings.EqualFold(s, p.State) {
+			vs = append(vs, Violation{RuleForbiddenStates, fmt.Sprintf("state %s is forbidden", p.State)})
+		}
+	}
+
+	if p.PolicyDetails == nil {
+		return vs
+	}
+
+	for _, s := range p.PolicyDetails.Schedules {
+		if s.RetainRule != nil {
+			if g.MinRetention > 0 && s.RetainRule.Count < g.MinRetention {
+				vs = append(vs, Violation{RuleMinRetention, fmt.Sprintf("schedule %s retains %d snapshots, below the minimum of %d", s.Name, s.RetainRule.Count, g.MinRetention)})
+			}
+
+			if g.MaxRetention > 0 && s.RetainRule.Count > g.MaxRetention {
+				vs = append(vs, Violation{RuleMaxRetention, fmt.Sprintf("schedule %s retains %d snapshots, above the maximum of %d", s.Name, s.RetainRule.Count, g.MaxRetention)})
+			}
+		}
+
+		if s.CreateRule != nil && len(g.AllowedIntervals) > 0 && !containsInt(g.AllowedIntervals, s.CreateRule.Interval) {
+			vs = append(vs, Violation{RuleAllowedIntervals, fmt.Sprintf("schedule %s interval %d is not allowed", s.Name, s.CreateRule.Interval)})
+		}
+
+		for _, k := range g.RequiredTags {
+			if !hasTag(s.TagsToAdd, k) {
+				vs = append(vs, Violation{RuleRequiredTags, fmt.Sprintf("schedule %s doesn't add tag %s", s.Name, k)})
+			}
+		}
+	}
+
+	return vs
+}
+
+// Check policy against the configured guardrails or
+// those stored in the bucket
+func (u Upserter) checkGuardrails(f *file.Policy) error {
+	g, err := u.guardrails()
+	if err != nil || g == nil {
+		return err
+	}
+
+	if vs := g.Evaluate(f); len(vs) > 0 {
+		return &GuardrailError{
+			Key:        u.item.record.S3.Object.Key,
+			Violations: vs,
+		}
+	}
+
+	return nil
+}
+
+// Configured guardrails, or those of the event's bucket
+func (u Upserter) guardrails() (*Guardrails, error) {
+	if u.config != nil && u.config.Guardrails != nil {
+		return u.config.Guardrails, nil
+	}
+
+	bucket := u.item.record.S3.Bucket.Name
+	if bucket == "" {
+		return nil, nil
+	}
+
+	return LoadGuardrails(bucket, u.client.S3Downloader)
+}
+
+// If value matches any of the patterns
+func matchAny(patterns []string, v string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, v); ok || p == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsInt(list []int64, v int64) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasTag(tags []*file.Tag, key string) bool {
+	for _, t := range tags {
+		if t.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
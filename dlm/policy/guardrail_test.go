@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+const guardrails = `
+MinRetention: 7
+MaxRetention: 30
+AllowedRoleArns:
+- arn:aws:iam::*:role/AWSDataLifecycleManagerDefaultRole
+RequiredTags:
+- CostCentre
+AllowedIntervals: [12, 24]
+ForbiddenStates: [DISABLED]
+`
+
+// Policy breaking every guardrail
+var badPolicy = &file.Policy{
+	ExecutionRoleArn: "arn:aws:iam::123456789101:role/Admin",
+	State:            "DISABLED",
+	PolicyDetails: &file.PolicyDetails{
+		Schedules: []*file.Schedule{
+			{
+				Name:       "Daily",
+				CreateRule: &file.CreateRule{Interval: 6},
+				RetainRule: &file.RetainRule{Count: 3},
+			},
+		},
+	},
+}
+
+func TestParseGuardrailsUnknownRule(t *testing.T) {
+	_, err := ParseGuardrails([]byte("MinRetentoin: 7"))
+	assert.Error(t, err)
+}
+
+func TestGuardrailsEvaluate(t *testing.T) {
+	g, err := ParseGuardrails([]byte(guardrails))
+	assert.NoError(t, err)
+
+	var rules []string
+	for _, v := range g.Evaluate(badPolicy) {
+		rules = append(rules, v.Rule)
+	}
+
+	assert.ElementsMatch(t, []string{
+		RuleAllowedRoleArns,
+		RuleForbiddenStates,
+		RuleMinRetention,
+		RuleAllowedIntervals,
+		RuleRequiredTags,
+	}, rules)
+}
+
+func TestGuardrailsEvaluatePass(t *testing.T) {
+	g, err := ParseGuardrails([]byte("MinRetention: 7\nAllowedIntervals: [24]"))
+	assert.NoError(t, err)
+
+	upserter := GetUpserterProcessor(false).(Upserter)
+	f, err := upserter.load()
+	assert.NoError(t, err)
+	assert.Empty(t, g.Evaluate(f))
+}
+
+func TestCreatePolicyGuardrailViolation(t *testing.T) {
+	record.EventName = "ObjectCreated:Put"
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: &test.MockDownloader{
+			Objects: map[string]string{
+				GuardrailsKey: "MinRetention: 14",
+			},
+		},
+		Dynamodb: new(test.MockDynamoDB),
+		Dlm:      new(test.MockDlm),
+	})
+	p.SetPolicy(record, context)
+
+	err := p.Dispatch().(Upserter).CreatePolicy()
+	assert.IsType(t, &GuardrailError{}, err)
+	assert.Contains(t, err.Error(), RuleMinRetention)
+}
+
+func TestLoadGuardrailsMissing(t *testing.T) {
+	g, err := LoadGuardrails("dummy-bucket", new(test.MockDownloader))
+	assert.NoError(t, err)
+	assert.Nil(t, g)
+}
@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Outcome of processing an event record
+type RecordResult struct {
+	Key       string `json:"key"`
+	EventName string `json:"eventName"`
+	Skipped   string `json:"skipped,omitempty"`
+	Err       error  `json:"-"`
+}
+
+// If the record was processed without error
+func (r *RecordResult) Ok() bool {
+	return r.Err == nil
+}
+
+// HandleRecords processes S3 event records the way the
+// lambda function does. Records of directories and of
+// reserved objects are skipped. Failed records are logged
+// as JSON so they can be replayed.
+func (p *Policy) HandleRecords(records []events.S3EventRecord, c lambdacontext.LambdaContext) []*RecordResult {
+	var results []*RecordResult
+	for _, record := range records {
+		r := &RecordResult{
+			Key:       record.S3.Object.Key,
+			EventName: record.EventName,
+		}
+		results = append(results, r)
+
+		// Ignore if event triggered is by directory lifecycle
+		if isDir(record.S3.Object.Key) {
+			r.Skipped = "not a file"
+			log.Println(fmt.Sprintf("%s Ignoring event triggered by %s because it is not a file", msgPrefix, record.S3.Object.Key))
+			continue
+		}
+
+		// Ignore configuration objects such as guardrails
+		if file.IsReserved(record.S3.Object.Key) {
+			r.Skipped = "reserved object"
+			log.Println(fmt.Sprintf("%s Ignoring event triggered by %s because it is a reserved object", msgPrefix, record.S3.Object.Key))
+			continue
+		}
+
+		// Ignore events delivered after a later one
+		if r.Err = p.SetPolicy(record, c); r.Err == nil && p.item.stale() {
+			r.Skipped = "out of order"
+			log.Println(fmt.Sprintf("%s Ignoring event triggered by %s because a later event has been applied", msgPrefix, objectRef(record)))
+			continue
+		}
+
+		if r.Err == nil {
+			r.Err = p.execute()
+		}
+
+		// A later event got to the record while this one was processed
+		if r.Err == db.ErrOutOfOrder {
+			r.Err, r.Skipped = nil, "out of order"
+			log.Println(fmt.Sprintf("%s Ignoring event triggered by %s because a later event has been applied", msgPrefix, objectRef(record)))
+			continue
+		}
+
+		if r.Err != nil {
+			// Logging event for debugging and replaying
+			if raw, err := json.Marshal(record); err == nil {
+				log.Println(fmt.Sprintf("%s %s", msgPrefix, raw))
+			}
+
+			if awsErr, ok := r.Err.(awserr.Error); ok {
+				log.Println("Error:", awsErr.Error())
+			} else {
+				log.Println(r.Err)
+			}
+
+			continue
+		}
+
+		log.Println(fmt.Sprintf("%s Successfully processed event triggered by %s", msgPrefix, objectRef(record)))
+	}
+
+	return results
+}
+
+// Key of the record's object with its version, if any
+func objectRef(record events.S3EventRecord) string {
+	if v := record.S3.Object.VersionID; v != "" {
+		return fmt.Sprintf("%s (version %s)", record.S3.Object.Key, v)
+	}
+
+	return record.S3.Object.Key
+}
+
+// If it's a S3 directory
+func isDir(s string) bool {
+	return strings.HasSuffix(s, "/")
+}
+
+// ParseRecords reads the event records to replay. It
+// accepts an S3 event, a single record, or log output
+// of the handler where every line holding a record is
+// read and the others are ignored.
+func ParseRecords(raw []byte) ([]events.S3EventRecord, error) {
+	event := new(events.S3Event)
+	if err := json.Unmarshal(raw, event); err == nil && len(event.Records) > 0 {
+		return event.Records, nil
+	}
+
+	record := new(events.S3EventRecord)
+	if err := json.Unmarshal(raw, record); err == nil && record.S3.Object.Key != "" {
+		return []events.S3EventRecord{*record}, nil
+	}
+
+	var records []events.S3EventRecord
+	for _, line := range strings.Split(string(raw), "\n") {
+		i := strings.Index(line, msgPrefix+" {")
+		if i < 0 {
+			continue
+		}
+
+		r := events.S3EventRecord{}
+		if err := json.Unmarshal([]byte(line[i+len(msgPrefix)+1:]), &r); err != nil || r.S3.Object.Key == "" {
+			continue
+		}
+
+		records = append(records, r)
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("Failed to find any S3 event record. Expected an S3 event, a record or the log of the handler")
+	}
+
+	return records, nil
+}
@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/local"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+func TestIsDir(t *testing.T) {
+	isD := "testing/"
+	assert.True(t, isDir(isD))
+
+	notD := "testing"
+	assert.False(t, isDir(notD))
+}
+
+func TestParseRecords(t *testing.T) {
+	raw, err := ioutil.ReadFile("../../testdata/s3_event.json")
+	assert.NoError(t, err)
+
+	// S3 event
+	records, err := ParseRecords(raw)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// Single record
+	single, err := json.Marshal(records[0])
+	assert.NoError(t, err)
+
+	records, err = ParseRecords(single)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "policy_example.yaml", records[0].S3.Object.Key)
+
+	// Log of the handler
+	log := "START RequestId: abc\n2019/01/02 03:04:05 " + msgPrefix + " " + string(single) + "\n2019/01/02 03:04:05 Error: denied\n"
+	records, err = ParseRecords([]byte(log))
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = ParseRecords([]byte("nothing to see"))
+	assert.Error(t, err)
+}
+
+func TestHandleRecords(t *testing.T) {
+	raw, err := ioutil.ReadFile("../../testdata/s3_event.json")
+	assert.NoError(t, err)
+
+	records, err := ParseRecords(raw)
+	assert.NoError(t, err)
+
+	conn := db.NewMemory()
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: local.Downloader{Dir: "../../testdata"},
+		Dlm:          local.NewDlm(),
+	})
+	p.SetDBConn(conn)
+
+	results := p.HandleRecords(records, lambdacontext.LambdaContext{AwsRequestID: "replay-1"})
+	assert.Len(t, results, 2)
+	assert.True(t, results[0].Ok())
+	assert.Empty(t, results[0].Skipped)
+	assert.Equal(t, "reserved object", results[1].Skipped)
+
+	di, err := conn.FindByKey("policy_example.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "policy-local-1", di.PolicyId)
+
+	// Replaying again takes the update path
+	results = p.HandleRecords(records[:1], lambdacontext.LambdaContext{})
+	assert.True(t, results[0].Ok())
+}
+
+func TestHandleRecordsOutOfOrder(t *testing.T) {
+	conn := db.NewMemory()
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: local.Downloader{Dir: "../../testdata"},
+		Dlm:          local.NewDlm(),
+	})
+	p.SetDBConn(conn)
+
+	event := func(name, sequencer string) events.S3EventRecord {
+		r := events.S3EventRecord{EventName: name}
+		r.S3.Object.Key = "policy_example.yaml"
+		r.S3.Object.Sequencer = sequencer
+		return r
+	}
+
+	results := p.HandleRecords([]events.S3EventRecord{
+		event(eventCreated, "0A"),
+		event(eventCreated, "09"),
+		event(eventRemoved, "0C"),
+		event(eventCreated, "0B"),
+	}, lambdacontext.LambdaContext{})
+
+	for _, r := range results {
+		assert.True(t, r.Ok())
+	}
+
+	assert.Empty(t, results[0].Skipped)
+	assert.Equal(t, "out of order", results[1].Skipped)
+	assert.Empty(t, results[2].Skipped)
+	assert.Equal(t, "out of order", results[3].Skipped)
+
+	// The delete left a tombstone
+	di, err := conn.FindByKey("policy_example.yaml")
+	assert.NoError(t, err)
+	assert.True(t, di.Deleted)
+	assert.Equal(t, db.PadSequencer("0C"), di.Sequencer)
+
+	// A later upload creates the policy again
+	results = p.HandleRecords([]events.S3EventRecord{event(eventCreated, "0D")}, lambdacontext.LambdaContext{})
+	assert.True(t, results[0].Ok())
+	assert.Empty(t, results[0].Skipped)
+
+	di, err = conn.FindByKey("policy_example.yaml")
+	assert.NoError(t, err)
+	assert.False(t, di.Deleted)
+	assert.Equal(t, "policy-local-2", di.PolicyId)
+}
+
+// Registry where a later event of the key is applied
+// right before the first write
+type laterEventDB struct {
+	*db.Memory
+	sequencer string
+}
+
+func (l *laterEventDB) Update(i *db.Item) error {
+	if l.sequencer != "" {
+		later := *i
+		later.Sequencer, l.sequencer = l.sequencer, ""
+		if err := l.Memory.Update(&later); err != nil {
+			return err
+		}
+	}
+
+	return l.Memory.Update(i)
+}
+
+func TestHandleRecordsClaimed(t *testing.T) {
+	conn := &laterEventDB{
+		Memory:    db.NewMemory(&db.Item{S3ObjectKey: "policy_example.yaml", PolicyId: "test-id", Sequencer: db.PadSequencer("0A"), Version: 1}),
+		sequencer: db.PadSequencer("0C"),
+	}
+
+	// DLM fails if it's called
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: local.Downloader{Dir: "../../testdata"},
+		Dlm:          &test.MockDlm{Err: errors.New("called")},
+	})
+	p.SetDBConn(conn)
+
+	r := events.S3EventRecord{EventName: eventCreated}
+	r.S3.Object.Key = "policy_example.yaml"
+	r.S3.Object.Sequencer = "0B"
+
+	results := p.HandleRecords([]events.S3EventRecord{r}, lambdacontext.LambdaContext{})
+	assert.True(t, results[0].Ok())
+	assert.Equal(t, "out of order", results[0].Skipped)
+}
+
+func TestHandleRecordsObjectVersion(t *testing.T) {
+	conn := db.NewMemory()
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: local.Downloader{Dir: "../../testdata"},
+		Dlm:          local.NewDlm(),
+	})
+	p.SetDBConn(conn)
+
+	r := events.S3EventRecord{EventName: eventCreated}
+	r.S3.Object.Key = "policy_example.yaml"
+	r.S3.Object.VersionID = "v1"
+	assert.Equal(t, "policy_example.yaml (version v1)", objectRef(r))
+
+	results := p.HandleRecords([]events.S3EventRecord{r}, lambdacontext.LambdaContext{})
+	assert.True(t, results[0].Ok())
+
+	di, err := conn.FindByKey("policy_example.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", di.ObjectVersion)
+
+	// Unchanged uploads record their version too
+	r.S3.Object.VersionID = "v2"
+	results = p.HandleRecords([]events.S3EventRecord{r}, lambdacontext.LambdaContext{})
+	assert.True(t, results[0].Ok())
+
+	di, err = conn.FindByKey("policy_example.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", di.ObjectVersion)
+}
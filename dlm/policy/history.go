@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// S3 version of a policy file
+type Version struct {
+	VersionId    string    `json:"versionId"`
+	LastModified time.Time `json:"lastModified"`
+	Size         int64     `json:"size"`
+	IsLatest     bool      `json:"isLatest"`
+	DeleteMarker bool      `json:"deleteMarker,omitempty"`
+}
+
+// List the versions of a policy file, newest first.
+// Deletions show up as delete markers.
+func ListVersions(bucket, key string, client s3iface.S3API) ([]*Version, error) {
+	var versions []*Version
+	err := client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(key),
+	}, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+		// The prefix also matches longer keys
+		for _, v := range page.Versions {
+			if aws.StringValue(v.Key) == key {
+				versions = append(versions, &Version{
+					VersionId:    aws.StringValue(v.VersionId),
+					LastModified: aws.TimeValue(v.LastModified),
+					Size:         aws.Int64Value(v.Size),
+					IsLatest:     aws.BoolValue(v.IsLatest),
+				})
+			}
+		}
+
+		for _, m := range page.DeleteMarkers {
+			if aws.StringValue(m.Key) == key {
+				versions = append(versions, &Version{
+					VersionId:    aws.StringValue(m.VersionId),
+					LastModified: aws.TimeValue(m.LastModified),
+					IsLatest:     aws.BoolValue(m.IsLatest),
+					DeleteMarker: true,
+				})
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(versions, func(a, b int) bool {
+		return versions[a].LastModified.After(versions[b].LastModified)
+	})
+
+	return versions, nil
+}
+
+// Load a version of a policy file
+func LoadVersion(bucket, key, versionId string, downloader s3manageriface.DownloaderAPI) (*file.Policy, error) {
+	raw, err := file.DownloadVersion(bucket, key, versionId, downloader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download version %s of %s: %v", versionId, key, err)
+	}
+
+	p, err := file.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse version %s of %s: %v", versionId, key, err)
+	}
+
+	return p, nil
+}
+
+// Newest version of a policy file that isn't a delete marker
+func latestVersion(bucket, key string, client s3iface.S3API) (string, error) {
+	versions, err := ListVersions(bucket, key, client)
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range versions {
+		if !v.DeleteMarker {
+			return v.VersionId, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s has no version that isn't deleted", key)
+}
+
+// DiffVersions compares two versions of a policy file field
+// by field. An empty version id is the latest version that
+// isn't deleted, so a deleted file can still be compared.
+func (p *Policy) DiffVersions(bucket, key, from, to string) ([]FieldDiff, error) {
+	var err error
+	for _, v := range []*string{&from, &to} {
+		if *v == "" {
+			if *v, err = latestVersion(bucket, key, p.client.S3); err != nil {
+				return nil, fmt.Errorf("Failed to find the latest version of %s: %v", key, err)
+			}
+		}
+	}
+
+	old, err := LoadVersion(bucket, key, from, p.client.S3Downloader)
+	if err != nil {
+		return nil, err
+	}
+
+	new, err := LoadVersion(bucket, key, to, p.client.S3Downloader)
+	if err != nil {
+		return nil, err
+	}
+
+	return Diff(old, new), nil
+}
+
+// Rollback applies an older version of a policy file to
+// DLM, the same way as if it had been uploaded again. The
+// version is kept in the record until the next update.
+// The object in the bucket isn't changed, so uploading
+// the file again supersedes the rollback.
+func (p *Policy) Rollback(bucket, key, versionId string, c lambdacontext.LambdaContext) error {
+	if versionId == "" {
+		return errors.New("Failed to roll back. The version id is missing")
+	}
+
+	f, err := LoadVersion(bucket, key, versionId, p.client.S3Downloader)
+	if err != nil {
+		return err
+	}
+
+	record := events.S3EventRecord{
+		EventName: eventCreated,
+		EventTime: time.Now().UTC(),
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: bucket},
+			Object: events.S3Object{Key: key, VersionID: versionId},
+		},
+	}
+
+	if err = p.SetPolicy(record, c); err != nil {
+		return err
+	}
+
+	p.item.source = f
+	p.item.rollbackVersion = versionId
+	p.item.force = true
+
+	return p.execute()
+}
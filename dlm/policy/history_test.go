@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Policy facade over a versioned policy file where
+// v1 keeps 14 snapshots instead of 7
+func GetVersionedPolicy(t *testing.T, items ...*db.Item) (*Policy, *db.Memory) {
+	raw, err := ioutil.ReadFile(test.SrcTestFile)
+	assert.NoError(t, err)
+
+	conn := db.NewMemory(items...)
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3: &test.MockS3{Payload: map[string]string{"versions": "deleted,v2,v1"}},
+		S3Downloader: &test.MockDownloader{
+			Objects: map[string]string{
+				"app.yaml?versionId=v1": strings.Replace(string(raw), "Count: 7", "Count: 14", 1),
+				"app.yaml?versionId=v2": string(raw),
+			},
+		},
+		Dlm: new(test.MockDlm),
+	})
+	p.SetDBConn(conn)
+
+	return p, conn
+}
+
+func TestListVersions(t *testing.T) {
+	p, _ := GetVersionedPolicy(t)
+
+	versions, err := ListVersions("dummy-bucket", "app.yaml", p.Clients().S3)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.True(t, versions[0].DeleteMarker)
+	assert.True(t, versions[0].IsLatest)
+	assert.Equal(t, "v2", versions[1].VersionId)
+	assert.Equal(t, "v1", versions[2].VersionId)
+}
+
+func TestDiffVersions(t *testing.T) {
+	p, _ := GetVersionedPolicy(t)
+
+	diffs, err := p.DiffVersions("dummy-bucket", "app.yaml", "v1", "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldDiff{{Field: "PolicyDetails.Schedules[0].RetainRule.Count", Old: int64(14), New: int64(7)}}, diffs)
+}
+
+func TestDiffVersionsLatestDeleted(t *testing.T) {
+	p, _ := GetVersionedPolicy(t)
+
+	// The latest version is a delete marker, which has no content
+	p.Clients().S3Downloader.(*test.MockDownloader).Objects["app.yaml"] = "{"
+
+	diffs, err := p.DiffVersions("dummy-bucket", "app.yaml", "", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldDiff{{Field: "PolicyDetails.Schedules[0].RetainRule.Count", Old: int64(7), New: int64(14)}}, diffs)
+}
+
+func TestRollback(t *testing.T) {
+	p, conn := GetVersionedPolicy(t, &db.Item{S3ObjectKey: "app.yaml", PolicyId: "test-id", CreatedAt: "c"})
+
+	err := p.Rollback("dummy-bucket", "app.yaml", "v1", lambdacontext.LambdaContext{AwsRequestID: "rollback-1"})
+	assert.NoError(t, err)
+
+	di, err := conn.FindByKey("app.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", di.RollbackVersion)
+	assert.Equal(t, "rollback-1", di.RequestId)
+	assert.Equal(t, "c", di.CreatedAt)
+
+	assert.Error(t, p.Rollback("dummy-bucket", "app.yaml", "", lambdacontext.LambdaContext{}))
+}
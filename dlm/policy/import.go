@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Policy brought under management
+type Imported struct {
+	PolicyId string `json:"policyId"`
+	Key      string `json:"key"`
+}
+
+// Import brings existing DLM policies under management.
+// Every policy that isn't in the registry yet is written
+// as <prefix>/<policy id>.yaml and registered with its
+// policy id. The record is created before the file is
+// written, so the upload event finds it and updates the
+// policy with the same content instead of creating a
+// duplicate. Without ids all the policies are imported.
+// Policies using settings a file can't hold are skipped,
+// as uploading their file would strip those settings.
+func (p *Policy) Import(w Writer, prefix string, ids []string, c lambdacontext.LambdaContext) ([]*Imported, error) {
+	input := new(dlm.GetLifecyclePoliciesInput)
+	if len(ids) > 0 {
+		input.SetPolicyIds(aws.StringSlice(ids))
+	}
+
+	output, err := p.client.Dlm.GetLifecyclePolicies(input)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := p.dbconn.All()
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make(map[string]string)
+	for _, i := range items {
+		managed[i.PolicyId] = i.S3ObjectKey
+	}
+
+	var imported []*Imported
+	for _, s := range output.Policies {
+		id := aws.StringValue(s.PolicyId)
+		if k, ok := managed[id]; ok {
+			log.Println(fmt.Sprintf("%s Skipping policy %s, it is already managed by %s", msgPrefix, id, k))
+			continue
+		}
+
+		key := path.Join(prefix, id+".yaml")
+		err := p.importPolicy(w, id, key, c)
+		if ue, ok := err.(*UnsupportedError); ok {
+			log.Println(fmt.Sprintf("%s Skipping policy %s, %v", warnPrefix, id, ue))
+			continue
+		} else if err != nil {
+			return imported, fmt.Errorf("Failed to import policy %s: %v", id, err)
+		}
+
+		imported = append(imported, &Imported{PolicyId: id, Key: key})
+	}
+
+	return imported, nil
+}
+
+// Write a single policy and register it
+func (p *Policy) importPolicy(w Writer, id, key string, c lambdacontext.LambdaContext) error {
+	output, err := p.client.Dlm.GetLifecyclePolicy(&dlm.GetLifecyclePolicyInput{
+		PolicyId: aws.String(id),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	f, err := NewPolicyFile(output.Policy)
+	if err != nil {
+		return err
+	}
+
+	raw, err := file.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	if di, err := p.dbconn.FindByKey(key); err != nil {
+		return err
+	} else if di != nil && !di.Deleted {
+		return fmt.Errorf("Key %s is already registered for policy %s", key, di.PolicyId)
+	}
+
+	now := fmt.Sprintf("%s", time.Now().UTC())
+	di := &db.Item{
+		S3ObjectKey: key,
+		PolicyId:    id,
+		RequestId:   c.AwsRequestID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Origin:      db.OriginLocal,
+	}
+
+	if err = p.dbconn.Create(di); err != nil {
+		return err
+	}
+
+	if err = w.Write(key, raw); err != nil {
+		// Don't leave a record behind without its file
+		if derr := p.dbconn.Delete(di); derr != nil {
+			log.Println(fmt.Sprintf("%s Failed to remove record of %s: %v", errorPrefix, key, derr))
+		}
+
+		return err
+	}
+
+	return nil
+}
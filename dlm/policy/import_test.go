@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Policy facade with two unmanaged DLM policies
+func GetImporter(items ...*db.Item) (*Policy, *db.Memory) {
+	conn := db.NewMemory(items...)
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		Dlm: &test.MockDlm{
+			Payload: map[string]string{
+				"policies": "policy-a,policy-b",
+			},
+		},
+	})
+	p.SetDBConn(conn)
+
+	return p, conn
+}
+
+func TestNewPolicyFile(t *testing.T) {
+	output, err := new(test.MockDlm).GetLifecyclePolicy(&dlm.GetLifecyclePolicyInput{})
+	assert.NoError(t, err)
+
+	f, err := NewPolicyFile(output.Policy)
+	assert.NoError(t, err)
+
+	// Same as the file the mock policy is made after
+	sources, err := LoadLocalSources("../../testdata", "")
+	assert.NoError(t, err)
+	assert.Equal(t, sources[0].Policy, f)
+
+	_, err = NewPolicyFile(&dlm.LifecyclePolicy{})
+	assert.Error(t, err)
+
+	// Defaults DLM fills in don't count as settings
+	output.Policy.PolicyDetails.SetPolicyType(dlm.PolicyTypeValuesEbsSnapshotManagement)
+	output.Policy.PolicyDetails.Schedules[0].SetCopyTags(false)
+	_, err = NewPolicyFile(output.Policy)
+	assert.NoError(t, err)
+
+	// Settings the file can't hold are named
+	output.Policy.PolicyDetails.Schedules[0].RetainRule.SetInterval(7).SetIntervalUnit("DAYS")
+	output.Policy.PolicyDetails.SetParameters(&dlm.Parameters{ExcludeBootVolume: aws.Bool(true)})
+	_, err = NewPolicyFile(output.Policy)
+	assert.Equal(t, &UnsupportedError{Fields: []string{
+		"PolicyDetails.Parameters",
+		"PolicyDetails.Schedules[0].RetainRule.Interval",
+		"PolicyDetails.Schedules[0].RetainRule.IntervalUnit",
+	}}, err)
+}
+
+func TestImportToBucket(t *testing.T) {
+	p, conn := GetImporter(&db.Item{S3ObjectKey: "policies/b.yaml", PolicyId: "policy-b"})
+	uploader := new(test.MockUploader)
+
+	imported, err := p.Import(BucketWriter{Bucket: "dummy-bucket", Uploader: uploader}, "policies", nil, lambdacontext.LambdaContext{AwsRequestID: "import-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Imported{{PolicyId: "policy-a", Key: "policies/policy-a.yaml"}}, imported)
+
+	// The file round trips to the live policy
+	f, err := file.Parse([]byte(uploader.Objects["policies/policy-a.yaml"]))
+	assert.NoError(t, err)
+	assert.Equal(t, "ENABLED", f.State)
+
+	di, err := conn.FindByKey("policies/policy-a.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "policy-a", di.PolicyId)
+	assert.Equal(t, "import-1", di.RequestId)
+	assert.True(t, di.IsLocal())
+}
+
+func TestImportSkipsUnsupported(t *testing.T) {
+	p, conn := GetImporter()
+	p.Clients().Dlm = &test.MockDlm{
+		Payload: map[string]string{
+			"policies": "policy-a,policy-b",
+			"cron":     "policy-a",
+		},
+	}
+	uploader := new(test.MockUploader)
+
+	imported, err := p.Import(BucketWriter{Bucket: "dummy-bucket", Uploader: uploader}, "policies", nil, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Imported{{PolicyId: "policy-b", Key: "policies/policy-b.yaml"}}, imported)
+
+	// Neither a file nor a record of the skipped policy
+	assert.NotContains(t, uploader.Objects, "policies/policy-a.yaml")
+	di, err := conn.FindByKey("policies/policy-a.yaml")
+	assert.NoError(t, err)
+	assert.Nil(t, di)
+}
+
+func TestImportToDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adlm-import")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, _ := GetImporter()
+	imported, err := p.Import(DirWriter{Dir: dir, Prefix: "policies"}, "policies", nil, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Len(t, imported, 2)
+
+	// Files load back under the same keys
+	sources, err := LoadLocalSources(dir, "policies")
+	assert.NoError(t, err)
+	assert.Len(t, sources, 2)
+	assert.Equal(t, "policies/policy-a.yaml", sources[0].Key)
+	assert.FileExists(t, filepath.Join(dir, "policy-b.yaml"))
+}
+
+func TestImportWriteFailure(t *testing.T) {
+	p, conn := GetImporter()
+
+	_, err := p.Import(BucketWriter{Uploader: &test.MockUploader{Err: errors.New("denied")}}, "", nil, lambdacontext.LambdaContext{})
+	assert.Error(t, err)
+
+	// The record is rolled back
+	items, err := conn.All()
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
@@ -0,0 +1,235 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Build the DLM create input from a policy file
+func NewCreateInput(f *file.Policy) (*dlm.CreateLifecyclePolicyInput, error) {
+	policyDetails, err := newPolicyDetails(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(dlm.CreateLifecyclePolicyInput).
+			SetDescription(f.Description).
+			SetExecutionRoleArn(f.ExecutionRoleArn).
+			SetPolicyDetails(policyDetails).
+			SetState(f.State),
+		nil
+}
+
+// Build the DLM update input of an existing policy from a policy file
+func NewUpdateInput(f *file.Policy, policyId string) (*dlm.UpdateLifecyclePolicyInput, error) {
+	policyDetails, err := newPolicyDetails(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(dlm.UpdateLifecyclePolicyInput).
+			SetDescription(f.Description).
+			SetExecutionRoleArn(f.ExecutionRoleArn).
+			SetPolicyDetails(policyDetails).
+			SetState(f.State).
+			SetPolicyId(policyId),
+		nil
+}
+
+// Map the policy details of the file to DLM
+func newPolicyDetails(f *file.Policy) (*dlm.PolicyDetails, error) {
+	if f.PolicyDetails == nil || len(f.PolicyDetails.Schedules) == 0 {
+		return nil, errors.New("Failed to map policy. PolicyDetails must have a schedule")
+	}
+
+	// Schedules
+	var schedules []*dlm.Schedule
+	for _, s := range f.PolicyDetails.Schedules {
+		if s.CreateRule == nil || s.RetainRule == nil {
+			return nil, errors.New("Failed to map policy. Schedules must have a CreateRule and a RetainRule")
+		}
+
+		// Retain Rule
+		retainRule := new(dlm.RetainRule).
+			SetCount(s.RetainRule.Count)
+
+		// Create Rule
+		createRule := new(dlm.CreateRule).
+			SetInterval(s.CreateRule.Interval).
+			SetIntervalUnit(s.CreateRule.IntervalUnit).
+			SetTimes(s.CreateRule.Times)
+
+		schedule := new(dlm.Schedule).
+			SetName(s.Name).
+			SetCreateRule(createRule).
+			SetRetainRule(retainRule).
+			SetTagsToAdd(newTags(s.TagsToAdd))
+
+		schedules = append(schedules, schedule)
+	}
+
+	return new(dlm.PolicyDetails).
+			SetResourceTypes([]*string{aws.String(f.PolicyDetails.ResourceTypes)}).
+			SetSchedules(schedules).
+			SetTargetTags(newTags(f.PolicyDetails.TargetTags)),
+		nil
+}
+
+func newTags(tags []*file.Tag) []*dlm.Tag {
+	var list []*dlm.Tag
+	for _, t := range tags {
+		list = append(list, &dlm.Tag{Key: aws.String(t.Key), Value: aws.String(t.Value)})
+	}
+
+	return list
+}
+
+// Map a DLM policy back to a policy file
+func NewPolicyFile(lp *dlm.LifecyclePolicy) (*file.Policy, error) {
+	if lp.PolicyDetails == nil {
+		return nil, errors.New("Failed to map policy. PolicyDetails is missing")
+	}
+
+	if len(lp.PolicyDetails.ResourceTypes) != 1 {
+		return nil, fmt.Errorf("Failed to map policy. Expected a single resource type, got %d", len(lp.PolicyDetails.ResourceTypes))
+	}
+
+	fields := unmapped("PolicyDetails", lp.PolicyDetails, "ResourceTypes", "TargetTags", "Schedules")
+	for i, s := range lp.PolicyDetails.Schedules {
+		name := fmt.Sprintf("PolicyDetails.Schedules[%d]", i)
+		fields = append(fields, unmapped(name, s, "Name", "CreateRule", "RetainRule", "TagsToAdd")...)
+		if s.CreateRule != nil {
+			fields = append(fields, unmapped(name+".CreateRule", s.CreateRule, "Interval", "IntervalUnit", "Times")...)
+		}
+
+		if s.RetainRule != nil {
+			fields = append(fields, unmapped(name+".RetainRule", s.RetainRule, "Count")...)
+		}
+	}
+
+	if len(fields) > 0 {
+		return nil, &UnsupportedError{Fields: fields}
+	}
+
+	details := &file.PolicyDetails{
+		ResourceTypes: aws.StringValue(lp.PolicyDetails.ResourceTypes[0]),
+		TargetTags:    newFileTags(lp.PolicyDetails.TargetTags),
+	}
+
+	for _, s := range lp.PolicyDetails.Schedules {
+		if s.CreateRule == nil || s.RetainRule == nil {
+			return nil, errors.New("Failed to map policy. Schedules must have a CreateRule and a RetainRule")
+		}
+
+		var times []*string
+		for _, t := range s.CreateRule.Times {
+			times = append(times, aws.String(aws.StringValue(t)))
+		}
+
+		details.Schedules = append(details.Schedules, &file.Schedule{
+			Name: aws.StringValue(s.Name),
+			CreateRule: &file.CreateRule{
+				Interval:     aws.Int64Value(s.CreateRule.Interval),
+				IntervalUnit: aws.StringValue(s.CreateRule.IntervalUnit),
+				Times:        times,
+			},
+			RetainRule: &file.RetainRule{
+				Count: aws.Int64Value(s.RetainRule.Count),
+			},
+			TagsToAdd: newFileTags(s.TagsToAdd),
+		})
+	}
+
+	return &file.Policy{
+		Description:      aws.StringValue(lp.Description),
+		ExecutionRoleArn: aws.StringValue(lp.ExecutionRoleArn),
+		State:            aws.StringValue(lp.State),
+		PolicyDetails:    details,
+	}, nil
+}
+
+// Values DLM fills in for settings a policy doesn't use
+var defaultValues = map[string]string{
+	"PolicyType":        "EBS_SNAPSHOT_MANAGEMENT",
+	"ResourceLocations": "CLOUD",
+	"Location":          "CLOUD",
+}
+
+// Error of a live policy using settings that a policy
+// file can't hold. Writing it as a file would drop them.
+type UnsupportedError struct {
+	Fields []string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("Failed to map policy. %s can't be represented in a policy file", strings.Join(e.Fields, ", "))
+}
+
+// Names of the fields of v, other than the mapped ones,
+// that hold something other than their default
+func unmapped(name string, v interface{}, mapped ...string) []string {
+	skip := make(map[string]bool)
+	for _, m := range mapped {
+		skip[m] = true
+	}
+
+	var fields []string
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if f.PkgPath != "" || skip[f.Name] || isDefault(rv.Field(i), defaultValues[f.Name]) {
+			continue
+		}
+
+		fields = append(fields, name+"."+f.Name)
+	}
+
+	return fields
+}
+
+// Whether v is unset, zero or the given default
+func isDefault(v reflect.Value, def string) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || isDefault(v.Elem(), def)
+	case reflect.Map:
+		return v.Len() == 0
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if !isDefault(v.Index(i), def) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath == "" && !isDefault(v.Field(i), defaultValues[f.Name]) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.String:
+		return v.String() == "" || v.String() == def
+	}
+
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func newFileTags(tags []*dlm.Tag) []*file.Tag {
+	var list []*file.Tag
+	for _, t := range tags {
+		list = append(list, &file.Tag{Key: aws.StringValue(t.Key), Value: aws.StringValue(t.Value)})
+	}
+
+	return list
+}
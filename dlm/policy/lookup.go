@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Delete the policy of a file that has no record,
+// e.g. because saving it failed after the create.
+// The policy is looked up in DLM and only deleted
+// when exactly one policy matches.
+func (d Deleter) deleteUnrecorded() error {
+	key := d.item.record.S3.Object.Key
+
+	policyId, match, err := d.lookup()
+	if err != nil {
+		return fmt.Errorf("Failed to delete. No record has been found in database for policy %s: %v", key, err)
+	}
+
+	_, err = d.client.Dlm.DeleteLifecyclePolicy(&dlm.DeleteLifecyclePolicyInput{
+		PolicyId: aws.String(policyId),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log.Println(fmt.Sprintf("%s No record of %s, deleted policy %s found by %s", warnPrefix, key, policyId, match))
+
+	if d.item.sequencer() == "" {
+		return nil
+	}
+
+	return d.dbconn.Delete(d.tombstone())
+}
+
+// Find the unregistered DLM policy of the file by its
+// provenance tags or, for policies created before they
+// were tagged, by the description and target tags of
+// the last version of the file.
+func (d Deleter) lookup() (string, string, error) {
+	p := &Policy{client: d.client, dbconn: d.dbconn}
+
+	items, err := p.dbconn.All()
+	if err != nil {
+		return "", "", err
+	}
+
+	lps, err := p.unregistered(items)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := d.item.record.S3.Object.Key
+	bucket := d.item.record.S3.Bucket.Name
+
+	var tagged []string
+	for _, lp := range lps {
+		if aws.StringValue(lp.Tags[TagManaged]) != "true" || aws.StringValue(lp.Tags[TagKey]) != key {
+			continue
+		}
+
+		if b, ok := lp.Tags[TagBucket]; ok && aws.StringValue(b) != bucket {
+			continue
+		}
+
+		tagged = append(tagged, aws.StringValue(lp.PolicyId))
+	}
+
+	if len(tagged) > 0 {
+		id, err := onlyMatch(tagged)
+		return id, MatchTags, err
+	}
+
+	f, err := d.lastVersion()
+	if err != nil {
+		return "", "", err
+	}
+
+	var matched []string
+	sources := []*Source{{Key: key, Policy: f}}
+	for _, lp := range lps {
+		k, err := matchSource(lp, sources)
+		if err != nil {
+			return "", "", err
+		}
+
+		if k != "" {
+			matched = append(matched, aws.StringValue(lp.PolicyId))
+		}
+	}
+
+	id, err := onlyMatch(matched)
+	return id, MatchContent, err
+}
+
+// Last version of the deleted file
+func (d Deleter) lastVersion() (*file.Policy, error) {
+	if d.client.S3 == nil {
+		return nil, errors.New("no policy is tagged with the file and its versions can't be listed")
+	}
+
+	bucket := d.item.record.S3.Bucket.Name
+	key := d.item.record.S3.Object.Key
+
+	versions, err := ListVersions(bucket, key, d.client.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if !v.DeleteMarker {
+			return LoadVersion(bucket, key, v.VersionId, d.client.S3Downloader)
+		}
+	}
+
+	return nil, errors.New("no policy is tagged with the file and there is no earlier version of it")
+}
+
+// The only policy id of the matches
+func onlyMatch(ids []string) (string, error) {
+	switch len(ids) {
+	case 0:
+		return "", errors.New("no matching policy found in DLM")
+	case 1:
+		return ids[0], nil
+	}
+
+	return "", fmt.Errorf("%d policies match, refusing to guess: %v", len(ids), ids)
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Deleter of a file without a record
+func GetUnrecordedDeleter(dlmPayload, s3Payload map[string]string) Deleter {
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3:           &test.MockS3{Payload: s3Payload},
+		S3Downloader: new(test.MockDownloader),
+		Dlm:          &test.MockDlm{Payload: dlmPayload},
+	})
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "other.yaml", PolicyId: "registered-id"}))
+
+	r := events.S3EventRecord{EventName: eventRemoved}
+	r.S3.Bucket.Name = "dummy-bucket"
+	r.S3.Object.Key = test.PolicyExampleFileName
+	p.SetPolicy(r, context)
+
+	return p.Dispatch().(Deleter)
+}
+
+func TestDeleteUnrecordedByTags(t *testing.T) {
+	d := GetUnrecordedDeleter(map[string]string{
+		"policies": "registered-id,orphan-id",
+		"managed":  test.PolicyExampleFileName,
+	}, nil)
+
+	id, match, err := d.lookup()
+	assert.NoError(t, err)
+	assert.Equal(t, "orphan-id", id)
+	assert.Equal(t, MatchTags, match)
+	assert.NoError(t, d.DeletePolicy())
+}
+
+func TestDeleteUnrecordedAmbiguous(t *testing.T) {
+	d := GetUnrecordedDeleter(map[string]string{
+		"policies": "a-id,b-id",
+		"managed":  test.PolicyExampleFileName,
+	}, nil)
+
+	err := d.DeletePolicy()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "2 policies match")
+}
+
+func TestDeleteUnrecordedByContent(t *testing.T) {
+	d := GetUnrecordedDeleter(
+		map[string]string{"policies": "orphan-id"},
+		map[string]string{"versions": "deleted,v1"},
+	)
+
+	id, match, err := d.lookup()
+	assert.NoError(t, err)
+	assert.Equal(t, "orphan-id", id)
+	assert.Equal(t, MatchContent, match)
+}
+
+func TestDeleteUnrecordedNoMatch(t *testing.T) {
+	d := GetUnrecordedDeleter(map[string]string{}, map[string]string{"versions": "deleted,v1"})
+
+	err := d.DeletePolicy()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no matching policy")
+
+	// Without earlier versions there's nothing to match
+	d = GetUnrecordedDeleter(map[string]string{"policies": "orphan-id"}, nil)
+	assert.Error(t, d.DeletePolicy())
+}
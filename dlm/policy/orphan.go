@@ -0,0 +1,258 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+)
+
+// Provenance tags added to the policies adlm-helper creates
+const (
+	TagManaged = "adlm-helper:managed"
+	TagBucket  = "adlm-helper:bucket"
+	TagKey     = "adlm-helper:key"
+
+	// Client token of the create, see CreatePolicy
+	TagToken = "adlm-helper:token"
+)
+
+// How an orphan was matched to its file
+const (
+	MatchTags    = "tags"
+	MatchContent = "content"
+)
+
+// Action of orphans matched by content only. They
+// might not come from adlm-helper, so they are never
+// deleted, only reported or adopted.
+const OrphanReport = "report"
+
+// Tags recording where a policy comes from
+func provenanceTags(r events.S3EventRecord) map[string]*string {
+	tags := map[string]*string{
+		TagManaged: aws.String("true"),
+		TagKey:     aws.String(r.S3.Object.Key),
+	}
+
+	if r.S3.Bucket.Name != "" {
+		tags[TagBucket] = aws.String(r.S3.Bucket.Name)
+	}
+
+	return tags
+}
+
+// DLM policy of adlm-helper without a registry record,
+// e.g. because saving the record failed after the
+// policy was created.
+type Orphan struct {
+	PolicyId string `json:"policyId"`
+	Key      string `json:"key"`
+	Match    string `json:"match"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+}
+
+// FindOrphans lists the DLM policies without a registry
+// record that carry the provenance tags, or whose
+// description and target tags match exactly one of the
+// sources. Each orphan comes with the action Sweep takes:
+// it's adopted by its key if configured to and the key
+// has a source but no record yet. Otherwise it's deleted
+// if it carries the provenance tags, or only reported.
+func (p *Policy) FindOrphans(sources []*Source) ([]*Orphan, error) {
+	if p.config == nil {
+		p.config = DefaultConfig()
+	}
+
+	items, err := p.dbconn.All()
+	if err != nil {
+		return nil, err
+	}
+
+	registered := make(map[string]bool)
+	for _, i := range items {
+		registered[i.S3ObjectKey] = true
+	}
+
+	// Policies of pending creates are resolved by SweepPending
+	pending, err := p.dbconn.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(map[string]bool)
+	for _, i := range pending {
+		tokens[i.ClientToken] = true
+	}
+
+	bySource := make(map[string]*Source)
+	for _, s := range sources {
+		bySource[s.Key] = s
+	}
+
+	lps, err := p.unregistered(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []*Orphan
+	for _, lp := range lps {
+		if tokens[aws.StringValue(lp.Tags[TagToken])] {
+			continue
+		}
+
+		o := &Orphan{PolicyId: aws.StringValue(lp.PolicyId)}
+		if aws.StringValue(lp.Tags[TagManaged]) == "true" {
+			o.Key = aws.StringValue(lp.Tags[TagKey])
+			o.Match = MatchTags
+		} else if key, err := matchSource(lp, sources); err != nil {
+			return nil, err
+		} else if key != "" {
+			o.Key = key
+			o.Match = MatchContent
+		} else {
+			continue
+		}
+
+		switch {
+		case o.Match == MatchContent && registered[o.Key]:
+			o.Action, o.Reason = OrphanReport, "matches the registered policy but isn't tagged as managed"
+		case o.Match == MatchContent && p.config.OrphanAction != OrphanAdopt:
+			o.Action, o.Reason = OrphanReport, "isn't tagged as managed, adopt it or delete it by hand"
+		case registered[o.Key]:
+			o.Action, o.Reason = OrphanDelete, "duplicate of the registered policy"
+		case bySource[o.Key] == nil:
+			o.Action, o.Reason = OrphanDelete, "policy file no longer exists"
+		case p.config.OrphanAction == OrphanAdopt:
+			o.Action, o.Reason = OrphanAdopt, "policy file has no record"
+		default:
+			o.Action, o.Reason = OrphanDelete, "orphans are configured to be deleted"
+		}
+
+		// Adopting the same key twice would leave duplicates
+		if o.Action == OrphanAdopt {
+			registered[o.Key] = true
+		}
+
+		orphans = append(orphans, o)
+	}
+
+	return orphans, nil
+}
+
+// DLM policies whose id isn't in the registry records
+func (p *Policy) unregistered(items []*db.Item) ([]*dlm.LifecyclePolicy, error) {
+	managed := make(map[string]bool)
+	for _, i := range items {
+		managed[i.PolicyId] = true
+	}
+
+	output, err := p.client.Dlm.GetLifecyclePolicies(new(dlm.GetLifecyclePoliciesInput))
+	if err != nil {
+		return nil, err
+	}
+
+	var lps []*dlm.LifecyclePolicy
+	for _, s := range output.Policies {
+		id := aws.StringValue(s.PolicyId)
+		if managed[id] {
+			continue
+		}
+
+		lp, err := p.getLivePolicy(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if lp != nil {
+			lps = append(lps, lp)
+		}
+	}
+
+	return lps, nil
+}
+
+// Key of the only source with the same description and
+// target tags as the policy. Empty if there is none or
+// the match is ambiguous.
+func matchSource(lp *dlm.LifecyclePolicy, sources []*Source) (string, error) {
+	live := &dlm.UpdateLifecyclePolicyInput{
+		Description:   lp.Description,
+		PolicyDetails: lp.PolicyDetails,
+	}
+
+	var matches []string
+	for _, s := range sources {
+		if s.Policy == nil {
+			continue
+		}
+
+		input, err := NewCreateInput(s.Policy)
+		if err != nil {
+			return "", fmt.Errorf("Failed to map %s: %v", s.Key, err)
+		}
+
+		diffs := filterDiffs(Diff(live, input), []string{"Description", "PolicyDetails.TargetTags"})
+		if len(diffs) == 0 {
+			matches = append(matches, s.Key)
+		}
+	}
+
+	if len(matches) != 1 {
+		return "", nil
+	}
+
+	return matches[0], nil
+}
+
+// Sweep adopts or deletes the orphans as listed
+func (p *Policy) Sweep(orphans []*Orphan, c lambdacontext.LambdaContext) error {
+	failed := 0
+	for _, o := range orphans {
+		if o.Action == OrphanReport {
+			log.Println(fmt.Sprintf("%s Orphan %s of %s left alone (%s)", warnPrefix, o.PolicyId, o.Key, o.Reason))
+			continue
+		}
+
+		if err := p.sweep(o, c); err != nil {
+			failed++
+			log.Println(fmt.Sprintf("%s Failed to %s orphan %s: %v", errorPrefix, o.Action, o.PolicyId, err))
+			continue
+		}
+
+		log.Println(fmt.Sprintf("%s Orphan %s of %s: %s (%s)", msgPrefix, o.PolicyId, o.Key, o.Action, o.Reason))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Failed to sweep %d orphan(s)", failed)
+	}
+
+	return nil
+}
+
+func (p *Policy) sweep(o *Orphan, c lambdacontext.LambdaContext) error {
+	if o.Action == OrphanDelete {
+		_, err := p.client.Dlm.DeleteLifecyclePolicy(&dlm.DeleteLifecyclePolicyInput{
+			PolicyId: aws.String(o.PolicyId),
+		})
+
+		return err
+	}
+
+	now := fmt.Sprintf("%s", time.Now().UTC())
+
+	return p.dbconn.Create(&db.Item{
+		S3ObjectKey: o.Key,
+		PolicyId:    o.PolicyId,
+		RequestId:   c.AwsRequestID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+}
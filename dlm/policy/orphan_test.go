@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Policy facade with the unregistered DLM policy orphan-id
+func GetOrphanFinder(action string, dlmPayload map[string]string, items ...*db.Item) (*Policy, *db.Memory, []*Source) {
+	dlmPayload["policies"] = "orphan-id"
+	conn := db.NewMemory(items...)
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{Dlm: &test.MockDlm{Payload: dlmPayload}})
+	p.SetDBConn(conn)
+
+	config := DefaultConfig()
+	config.OrphanAction = action
+	p.SetConfig(config)
+
+	sources, err := LoadLocalSources("../../testdata", "")
+	if err != nil {
+		panic(err)
+	}
+
+	return p, conn, sources
+}
+
+func TestHydrateProvenanceTags(t *testing.T) {
+	input, err := GetUpserterProcessor(false).(Upserter).hydrate()
+	assert.NoError(t, err)
+
+	tags := input.(*dlm.CreateLifecyclePolicyInput).Tags
+	assert.Equal(t, "true", aws.StringValue(tags[TagManaged]))
+	assert.Equal(t, test.PolicyExampleFileName, aws.StringValue(tags[TagKey]))
+	assert.Equal(t, "dummy-bucket", aws.StringValue(tags[TagBucket]))
+}
+
+func TestFindOrphansByTags(t *testing.T) {
+	p, conn, sources := GetOrphanFinder(OrphanAdopt, map[string]string{"managed": test.PolicyExampleFileName})
+
+	orphans, err := p.FindOrphans(sources)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Orphan{{
+		PolicyId: "orphan-id",
+		Key:      test.PolicyExampleFileName,
+		Match:    MatchTags,
+		Action:   OrphanAdopt,
+		Reason:   "policy file has no record",
+	}}, orphans)
+
+	assert.NoError(t, p.Sweep(orphans, lambdacontext.LambdaContext{AwsRequestID: "sweep-1"}))
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "orphan-id", di.PolicyId)
+}
+
+func TestFindOrphansDuplicate(t *testing.T) {
+	p, _, sources := GetOrphanFinder(OrphanAdopt,
+		map[string]string{"managed": test.PolicyExampleFileName},
+		&db.Item{S3ObjectKey: test.PolicyExampleFileName, PolicyId: "registered-id"},
+	)
+
+	orphans, err := p.FindOrphans(sources)
+	assert.NoError(t, err)
+	assert.Equal(t, OrphanDelete, orphans[0].Action)
+	assert.Equal(t, "duplicate of the registered policy", orphans[0].Reason)
+	assert.NoError(t, p.Sweep(orphans, lambdacontext.LambdaContext{}))
+}
+
+func TestFindOrphansByContent(t *testing.T) {
+	p, _, sources := GetOrphanFinder(OrphanDelete, map[string]string{})
+
+	orphans, err := p.FindOrphans(sources)
+	assert.NoError(t, err)
+	assert.Len(t, orphans, 1)
+	assert.Equal(t, MatchContent, orphans[0].Match)
+
+	// Policies without the provenance tags are never deleted
+	assert.Equal(t, OrphanReport, orphans[0].Action)
+	p.client.Dlm.(*test.MockDlm).Err = errors.New("Deleted")
+	assert.NoError(t, p.Sweep(orphans, lambdacontext.LambdaContext{}))
+	p.client.Dlm.(*test.MockDlm).Err = nil
+
+	// Ambiguous matches are left alone
+	orphans, err = p.FindOrphans(append(sources, &Source{Key: "copy.yaml", Policy: sources[0].Policy}))
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+}
+
+func TestFindOrphansByContentAdopt(t *testing.T) {
+	p, _, sources := GetOrphanFinder(OrphanAdopt, map[string]string{})
+
+	orphans, err := p.FindOrphans(sources)
+	assert.NoError(t, err)
+	assert.Len(t, orphans, 1)
+	assert.Equal(t, OrphanAdopt, orphans[0].Action)
+}
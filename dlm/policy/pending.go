@@ -0,0 +1,193 @@
+package policy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+)
+
+// How long a create can be pending before it's taken
+// over. Longer than the function timeout, so the
+// invocation that started it has ended by then.
+const PendingTimeout = 2 * time.Minute
+
+// Random token identifying a create
+func newClientToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// If the pending record may still be worked on
+func inProgress(i *db.Item, timeout time.Duration) bool {
+	since, err := time.Parse(time.RFC3339, i.PendingSince)
+	return err == nil && time.Since(since) < timeout
+}
+
+// Id of the unregistered DLM policy created with the
+// client token. Empty if there is none.
+func (p *Policy) findByToken(token string) (string, error) {
+	if token == "" {
+		return "", errors.New("The pending record has no client token")
+	}
+
+	items, err := p.dbconn.All()
+	if err != nil {
+		return "", err
+	}
+
+	lps, err := p.unregistered(items)
+	if err != nil {
+		return "", err
+	}
+
+	for _, lp := range lps {
+		if aws.StringValue(lp.Tags[TagToken]) == token {
+			return aws.StringValue(lp.PolicyId), nil
+		}
+	}
+
+	return "", nil
+}
+
+// ResumeCreate finishes a create whose record is still
+// pending, e.g. because the invocation timed out. The
+// policy created with the record's token is updated with
+// the file and committed. It's only created again if DLM
+// has none.
+func (u Upserter) ResumeCreate() error {
+	pending := u.item.dbItem
+	key := u.item.record.S3.Object.Key
+
+	if inProgress(pending, PendingTimeout) {
+		return fmt.Errorf("Failed to create. The policy of %s is being created since %s", key, pending.PendingSince)
+	}
+
+	policyId, err := (&Policy{client: u.client, dbconn: u.dbconn}).findByToken(pending.ClientToken)
+	if err != nil {
+		return err
+	}
+
+	if policyId == "" {
+		log.Println(fmt.Sprintf("%s Resuming pending create of %s, no policy was created", warnPrefix, key))
+
+		input, hash, err := u.createInput()
+		if err != nil {
+			return err
+		}
+
+		return u.create(input, hash, pending)
+	}
+
+	log.Println(fmt.Sprintf("%s Resuming pending create of %s with policy %s", warnPrefix, key, policyId))
+
+	f, err := u.load()
+	if err != nil {
+		return err
+	}
+
+	input, err := NewUpdateInput(f, policyId)
+	if err != nil {
+		return err
+	}
+
+	if err = u.preflight(input.PolicyDetails); err != nil {
+		return err
+	}
+
+	hash, err := InputHash(input)
+	if err != nil {
+		return err
+	}
+
+	u.debug(input)
+
+	if _, err = u.client.Dlm.UpdateLifecyclePolicy(input); err != nil {
+		return err
+	}
+
+	return u.commit(pending, policyId, hash)
+}
+
+// Delete the policy of a pending create, if it was
+// created, and the record
+func (d Deleter) deletePending() error {
+	if err := d.item.claim(d.dbconn); err != nil {
+		return err
+	}
+
+	policyId, err := (&Policy{client: d.client, dbconn: d.dbconn}).findByToken(d.item.dbItem.ClientToken)
+	if err != nil {
+		return err
+	}
+
+	if policyId != "" {
+		_, err = d.client.Dlm.DeleteLifecyclePolicy(&dlm.DeleteLifecyclePolicyInput{
+			PolicyId: aws.String(policyId),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.dbconn.Delete(d.tombstone())
+}
+
+// SweepPending resolves the creates pending for longer
+// than the timeout, whose invocations must have failed.
+// A record is committed with the policy created with its
+// token or deleted if there is none. The next upload or
+// reconciliation applies the file. Returns the number
+// of records resolved.
+func (p *Policy) SweepPending(timeout time.Duration) (int, error) {
+	items, err := p.dbconn.Pending()
+	if err != nil {
+		return 0, err
+	}
+
+	resolved := 0
+	for _, i := range items {
+		if inProgress(i, timeout) {
+			continue
+		}
+
+		policyId, err := p.findByToken(i.ClientToken)
+		if err != nil {
+			return resolved, fmt.Errorf("Failed to resolve pending create of %s: %v", i.S3ObjectKey, err)
+		}
+
+		if policyId == "" {
+			err = p.dbconn.Delete(&db.Item{S3ObjectKey: i.S3ObjectKey, Version: i.Version})
+		} else {
+			err = p.dbconn.Update(&db.Item{
+				S3ObjectKey: i.S3ObjectKey,
+				PolicyId:    policyId,
+				RequestId:   i.RequestId,
+				CreatedAt:   i.CreatedAt,
+				UpdatedAt:   i.UpdatedAt,
+				Version:     i.Version,
+			})
+		}
+
+		if err != nil {
+			return resolved, fmt.Errorf("Failed to resolve pending create of %s: %v", i.S3ObjectKey, err)
+		}
+
+		resolved++
+		log.Println(fmt.Sprintf("%s Resolved pending create of %s since %s, policy: %s", warnPrefix, i.S3ObjectKey, i.PendingSince, dash(policyId)))
+	}
+
+	return resolved, nil
+}
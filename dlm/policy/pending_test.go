@@ -0,0 +1,209 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dlm"
+	"github.com/aws/aws-sdk-go/service/dlm/dlmiface"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/local"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Pending record of the policy example
+func pendingItem(key, token string, since time.Duration) *db.Item {
+	return &db.Item{
+		S3ObjectKey:  key,
+		CreatedAt:    "c",
+		State:        db.StatePending,
+		ClientToken:  token,
+		PendingSince: time.Now().UTC().Add(-since).Format(time.RFC3339),
+	}
+}
+
+// Policy facade over the given DLM and records
+func GetPendingPolicy(client dlmiface.DLMAPI, eventName string, items ...*db.Item) (*Policy, *db.Memory) {
+	conn := db.NewMemory(items...)
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: local.Downloader{Dir: "../../testdata"},
+		Dlm:          client,
+	})
+	p.SetDBConn(conn)
+
+	r := events.S3EventRecord{EventName: eventName}
+	r.S3.Object.Key = test.PolicyExampleFileName
+	p.SetPolicy(r, context)
+
+	return p, conn
+}
+
+// In memory DLM with a policy created with the token
+func GetTokenDlm(token string) *local.Dlm {
+	d := local.NewDlm()
+	d.CreateLifecyclePolicy(&dlm.CreateLifecyclePolicyInput{
+		Description: aws.String("Created before the timeout"),
+		Tags:        map[string]*string{TagToken: aws.String(token)},
+	})
+
+	return d
+}
+
+func TestCreatePolicyCommits(t *testing.T) {
+	p, conn := GetPendingPolicy(local.NewDlm(), eventCreated)
+	assert.NoError(t, p.Dispatch().Execute())
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "policy-local-1", di.PolicyId)
+	assert.False(t, di.IsPending())
+	assert.Empty(t, di.ClientToken)
+
+	lp, err := p.getLivePolicy("policy-local-1")
+	assert.NoError(t, err)
+	assert.Len(t, aws.StringValue(lp.Tags[TagToken]), 32)
+}
+
+func TestCreatePolicyStaysPending(t *testing.T) {
+	p, conn := GetPendingPolicy(&test.MockDlm{Err: errors.New("timeout")}, eventCreated)
+	assert.Error(t, p.Dispatch().Execute())
+
+	pending, err := conn.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.NotEmpty(t, pending[0].ClientToken)
+
+	items, err := conn.All()
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+
+	// Rejected creates don't leave a record behind
+	p, conn = GetPendingPolicy(&test.MockDlm{Err: awserr.New(dlm.ErrCodeInvalidRequestException, "invalid", nil)}, eventCreated)
+	assert.Error(t, p.Dispatch().Execute())
+
+	pending, err = conn.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestCreatePolicyPendingSequencer(t *testing.T) {
+	p, conn := GetPendingPolicy(&test.MockDlm{Err: errors.New("timeout")}, eventCreated)
+	p.item.record.S3.Object.Sequencer = "0A"
+	assert.Error(t, p.Dispatch().Execute())
+
+	// Older events can't write the pending record
+	pending, err := conn.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, db.PadSequencer("0A"), pending[0].Sequencer)
+}
+
+// DLM where the recorded policy is gone and creates time out
+type recreateDlm struct {
+	*test.MockDlm
+}
+
+func (d recreateDlm) UpdateLifecyclePolicy(*dlm.UpdateLifecyclePolicyInput) (*dlm.UpdateLifecyclePolicyOutput, error) {
+	return nil, awserr.New(dlm.ErrCodeResourceNotFoundException, "Policy not found", nil)
+}
+
+func (d recreateDlm) CreateLifecyclePolicy(*dlm.CreateLifecyclePolicyInput) (*dlm.CreateLifecyclePolicyOutput, error) {
+	return nil, errors.New("timeout")
+}
+
+func TestRecreatePolicyStaysPending(t *testing.T) {
+	p, conn := GetPendingPolicy(recreateDlm{new(test.MockDlm)}, eventCreated,
+		&db.Item{S3ObjectKey: test.PolicyExampleFileName, PolicyId: "gone-id", CreatedAt: "c"},
+	)
+	assert.Error(t, p.Dispatch().Execute())
+
+	// The replacement is resumed like a new create
+	pending, err := conn.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.NotEmpty(t, pending[0].ClientToken)
+	assert.Equal(t, "c", pending[0].CreatedAt)
+}
+
+func TestResumeCreateFound(t *testing.T) {
+	d := GetTokenDlm("t1")
+	p, conn := GetPendingPolicy(d, eventCreated, pendingItem(test.PolicyExampleFileName, "t1", time.Hour))
+	assert.NoError(t, p.Dispatch().Execute())
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "policy-local-1", di.PolicyId)
+	assert.Equal(t, "c", di.CreatedAt)
+	assert.False(t, di.IsPending())
+
+	// Updated with the file instead of created again
+	output, err := d.GetLifecyclePolicies(new(dlm.GetLifecyclePoliciesInput))
+	assert.NoError(t, err)
+	assert.Len(t, output.Policies, 1)
+	assert.Equal(t, "My Awesome Data Lifecycl Management Daily Snapshot", aws.StringValue(output.Policies[0].Description))
+}
+
+func TestResumeCreateNotFound(t *testing.T) {
+	p, conn := GetPendingPolicy(local.NewDlm(), eventCreated, pendingItem(test.PolicyExampleFileName, "t1", time.Hour))
+	assert.NoError(t, p.Dispatch().Execute())
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "policy-local-1", di.PolicyId)
+
+	lp, err := p.getLivePolicy("policy-local-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1", aws.StringValue(lp.Tags[TagToken]))
+}
+
+func TestResumeCreateInProgress(t *testing.T) {
+	p, _ := GetPendingPolicy(local.NewDlm(), eventCreated, pendingItem(test.PolicyExampleFileName, "t1", 0))
+
+	err := p.Dispatch().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is being created since")
+}
+
+func TestDeletePending(t *testing.T) {
+	d := GetTokenDlm("t1")
+	p, conn := GetPendingPolicy(d, eventRemoved, pendingItem(test.PolicyExampleFileName, "t1", 0))
+	assert.NoError(t, p.Dispatch().Execute())
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Nil(t, di)
+
+	lp, err := p.getLivePolicy("policy-local-1")
+	assert.NoError(t, err)
+	assert.Nil(t, lp)
+}
+
+func TestSweepPending(t *testing.T) {
+	p, conn := GetPendingPolicy(GetTokenDlm("t1"), eventCreated,
+		pendingItem("created.yaml", "t1", time.Hour),
+		pendingItem("failed.yaml", "t2", time.Hour),
+		pendingItem("running.yaml", "t3", 0),
+	)
+
+	resolved, err := p.SweepPending(PendingTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, resolved)
+
+	items, err := conn.All()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "created.yaml", items[0].S3ObjectKey)
+	assert.Equal(t, "policy-local-1", items[0].PolicyId)
+
+	pending, err := conn.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "running.yaml", pending[0].S3ObjectKey)
+}
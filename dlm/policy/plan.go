@@ -0,0 +1,339 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Plan actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionNoOp   = "no-op"
+
+	// The object isn't a valid policy file, nothing is done
+	ActionInvalid = "invalid"
+)
+
+// Input fields a policy file can set.
+// DLM returns more fields than that, e.g. defaults,
+// which must not show up as changes.
+var managedFields = []string{
+	"Description",
+	"ExecutionRoleArn",
+	"State",
+	"PolicyDetails.ResourceTypes",
+	"PolicyDetails.TargetTags",
+	"PolicyDetails.Schedules[].Name",
+	"PolicyDetails.Schedules[].CreateRule.Interval",
+	"PolicyDetails.Schedules[].CreateRule.IntervalUnit",
+	"PolicyDetails.Schedules[].CreateRule.Times",
+	"PolicyDetails.Schedules[].RetainRule.Count",
+	"PolicyDetails.Schedules[].TagsToAdd",
+}
+
+// Change the handler would make for a policy file
+type Change struct {
+	Action   string      `json:"action"`
+	Key      string      `json:"key"`
+	PolicyId string      `json:"policyId,omitempty"`
+	Diffs    []FieldDiff `json:"diffs,omitempty"`
+	Note     string      `json:"note,omitempty"`
+
+	// Policy file to apply
+	source *file.Policy
+
+	// Version the file is pinned to by a rollback
+	rollbackVersion string
+
+	// The recorded policy doesn't exist in DLM
+	missing bool
+
+	// The file changed since it was last applied
+	missed bool
+}
+
+// Plan works out what uploading the sources to the
+// bucket prefix would do, without making any change.
+// Inputs are built by the same hydrate as the handler
+// and compared with the live policies in DLM.
+// Registry records under the prefix without a source
+// are planned for deletion, unless they were never
+// written from a policy file, e.g. imported into a
+// directory whose files aren't uploaded yet.
+func (p *Policy) Plan(sources []*Source, prefix string) ([]*Change, error) {
+	return p.plan(sources, prefix, false)
+}
+
+// Plan the sources. Records of local files are only
+// planned for deletion if the sources aren't the bucket.
+func (p *Policy) plan(sources []*Source, prefix string, bucket bool) ([]*Change, error) {
+	items, err := p.dbconn.All()
+	if err != nil {
+		return nil, err
+	}
+
+	registry := make(map[string]*db.Item)
+	for _, i := range items {
+		registry[i.S3ObjectKey] = i
+	}
+
+	var changes []*Change
+	seen := make(map[string]bool)
+	for _, s := range sources {
+		seen[s.Key] = true
+
+		if s.Err != nil {
+			c := &Change{Action: ActionInvalid, Key: s.Key, Note: s.Err.Error()}
+			if di := registry[s.Key]; di != nil {
+				c.PolicyId = di.PolicyId
+			}
+
+			changes = append(changes, c)
+			continue
+		}
+
+		c, err := p.planSource(s, registry[s.Key])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to plan %s: %v", s.Key, err)
+		}
+
+		changes = append(changes, c)
+	}
+
+	for _, i := range items {
+		if seen[i.S3ObjectKey] || !strings.HasPrefix(i.S3ObjectKey, prefix) || !i.HasSource() {
+			continue
+		}
+
+		// Applied from local files, the bucket doesn't have them
+		if bucket && i.IsLocal() {
+			continue
+		}
+
+		c := &Change{Action: ActionDelete, Key: i.S3ObjectKey, PolicyId: i.PolicyId}
+
+		live, err := p.livePolicy(i.PolicyId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to plan %s: %v", i.S3ObjectKey, err)
+		}
+
+		if live == nil {
+			c.Note = "policy not found in DLM"
+		} else {
+			c.Diffs = filterDiffs(Diff(live, nil), managedFields)
+		}
+
+		changes = append(changes, c)
+	}
+
+	sort.SliceStable(changes, func(a, b int) bool {
+		return changes[a].Key < changes[b].Key
+	})
+
+	return changes, nil
+}
+
+// PlanBucket plans the policy objects of a bucket prefix.
+// Files rolled back to a version are planned from that
+// version, so the rollback is kept. Records applied
+// from local files aren't planned for deletion.
+func (p *Policy) PlanBucket(bucket, prefix string) ([]*Change, error) {
+	sources, err := LoadBucketSources(bucket, prefix, p.client.S3, p.client.S3Downloader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.pinRollbacks(bucket, sources); err != nil {
+		return nil, err
+	}
+
+	return p.plan(sources, prefix, true)
+}
+
+// Replace the sources of files rolled back to a version
+// with that version
+func (p *Policy) pinRollbacks(bucket string, sources []*Source) error {
+	items, err := p.dbconn.All()
+	if err != nil {
+		return err
+	}
+
+	rollbacks := make(map[string]string)
+	for _, i := range items {
+		rollbacks[i.S3ObjectKey] = i.RollbackVersion
+	}
+
+	for _, s := range sources {
+		v := rollbacks[s.Key]
+		if v == "" {
+			continue
+		}
+
+		f, err := LoadVersion(bucket, s.Key, v, p.client.S3Downloader)
+		s.Policy, s.RollbackVersion, s.Err = f, v, err
+	}
+
+	return nil
+}
+
+// Plan the change of a single source
+func (p *Policy) planSource(s *Source, di *db.Item) (*Change, error) {
+	u := Upserter{
+		item:   &eventItem{dbItem: di, source: s.Policy},
+		client: p.client,
+		dbconn: p.dbconn,
+		config: p.config,
+	}
+
+	input, err := u.hydrate()
+	if err != nil {
+		return nil, err
+	}
+
+	if di == nil {
+		return &Change{
+			Action: ActionCreate,
+			Key:    s.Key,
+			Diffs:  filterDiffs(Diff(nil, input), managedFields),
+			source: s.Policy,
+		}, nil
+	}
+
+	c := &Change{Action: ActionUpdate, Key: s.Key, PolicyId: di.PolicyId, source: s.Policy, rollbackVersion: s.RollbackVersion}
+	if s.RollbackVersion != "" {
+		c.Note = fmt.Sprintf("rolled back to version %s", s.RollbackVersion)
+	}
+
+	// A file whose input differs from the one last applied
+	// is an update that was never applied, not drift.
+	// Records without a hash can't tell.
+	hash, err := InputHash(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if di.Hash != "" && hash != di.Hash {
+		c.missed = true
+		c.Note = "file changed since it was last applied"
+	}
+
+	live, err := p.livePolicy(di.PolicyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if live == nil {
+		c.missing = true
+		c.Note = "policy not found in DLM, it will be recreated"
+		c.Diffs = filterDiffs(Diff(nil, input), managedFields)
+		return c, nil
+	}
+
+	if c.Diffs = filterDiffs(Diff(live, input), managedFields); len(c.Diffs) == 0 {
+		c.Action = ActionNoOp
+	}
+
+	return c, nil
+}
+
+// Live DLM policy in the shape of an update input.
+// Nil if the policy doesn't exist.
+func (p *Policy) livePolicy(policyId string) (*dlm.UpdateLifecyclePolicyInput, error) {
+	lp, err := p.getLivePolicy(policyId)
+	if err != nil || lp == nil {
+		return nil, err
+	}
+
+	return &dlm.UpdateLifecyclePolicyInput{
+		Description:      lp.Description,
+		ExecutionRoleArn: lp.ExecutionRoleArn,
+		PolicyDetails:    lp.PolicyDetails,
+		PolicyId:         aws.String(policyId),
+		State:            lp.State,
+	}, nil
+}
+
+// Get a DLM policy. Nil if it doesn't exist.
+func (p *Policy) getLivePolicy(policyId string) (*dlm.LifecyclePolicy, error) {
+	output, err := p.client.Dlm.GetLifecyclePolicy(&dlm.GetLifecyclePolicyInput{
+		PolicyId: aws.String(policyId),
+	})
+
+	if notFound(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Policy, nil
+}
+
+// Print the changes in a terraform like format
+func WritePlan(w io.Writer, changes []*Change) {
+	symbols := map[string]string{
+		ActionCreate:  "+",
+		ActionUpdate:  "~",
+		ActionDelete:  "-",
+		ActionInvalid: "!",
+	}
+
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Action]++
+		if c.Action == ActionNoOp {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s %s %s", symbols[c.Action], c.Action, c.Key)
+		if c.PolicyId != "" {
+			fmt.Fprintf(w, " (%s)", c.PolicyId)
+		}
+		fmt.Fprintln(w)
+
+		if c.Note != "" {
+			fmt.Fprintf(w, "    # %s\n", c.Note)
+		}
+
+		WriteDiffs(w, c.Diffs, "    ")
+		fmt.Fprintln(w)
+	}
+
+	invalid := ""
+	if counts[ActionInvalid] > 0 {
+		invalid = fmt.Sprintf(" %d invalid file(s) skipped.", counts[ActionInvalid])
+	}
+
+	if counts[ActionCreate]+counts[ActionUpdate]+counts[ActionDelete] == 0 {
+		fmt.Fprintf(w, "No changes. %d policy(ies) up to date.%s\n", counts[ActionNoOp], invalid)
+		return
+	}
+
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete, %d unchanged.%s\n",
+		counts[ActionCreate], counts[ActionUpdate], counts[ActionDelete], counts[ActionNoOp], invalid)
+}
+
+// Print field differences, one per line
+func WriteDiffs(w io.Writer, diffs []FieldDiff, indent string) {
+	for _, d := range diffs {
+		switch {
+		case d.Old == nil:
+			fmt.Fprintf(w, "%s+ %s: %s\n", indent, d.Field, formatValue(d.New))
+		case d.New == nil:
+			fmt.Fprintf(w, "%s- %s: %s\n", indent, d.Field, formatValue(d.Old))
+		default:
+			fmt.Fprintf(w, "%s~ %s: %s -> %s\n", indent, d.Field, formatValue(d.Old), formatValue(d.New))
+		}
+	}
+}
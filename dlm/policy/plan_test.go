@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Planner over the testdata directory
+func GetPlanner(dlmPayload map[string]string, items ...*db.Item) (*Policy, []*Source) {
+	p := new(Policy)
+	p.SetClients(&AwsClients{Dlm: &test.MockDlm{Payload: dlmPayload}})
+	p.SetDBConn(db.NewMemory(items...))
+
+	sources, err := LoadLocalSources("../../testdata", "policies")
+	if err != nil {
+		panic(err)
+	}
+
+	return p, sources
+}
+
+func TestLoadLocalSources(t *testing.T) {
+	_, sources := GetPlanner(nil)
+
+	assert.Len(t, sources, 1)
+	assert.Equal(t, "policies/"+test.PolicyExampleFileName, sources[0].Key)
+	assert.Equal(t, "ENABLED", sources[0].Policy.State)
+}
+
+func TestDiff(t *testing.T) {
+	type tag struct{ Key, Value *string }
+	type details struct {
+		State *string
+		Tags  []tag
+	}
+
+	a, b, c := "a", "b", "c"
+	diffs := Diff(
+		&details{State: &a, Tags: []tag{{Key: &a, Value: &b}}},
+		&details{State: &b, Tags: []tag{{Key: &a}, {Key: &c}}},
+	)
+
+	assert.Equal(t, []FieldDiff{
+		{Field: "State", Old: "a", New: "b"},
+		{Field: "Tags[1].Key", New: "c"},
+		{Field: "Tags[0].Value", Old: "b"},
+	}, diffs)
+}
+
+func TestPlanCreate(t *testing.T) {
+	p, sources := GetPlanner(nil)
+
+	changes, err := p.Plan(sources, "policies/")
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, ActionCreate, changes[0].Action)
+	assert.Contains(t, changes[0].Diffs, FieldDiff{Field: "State", New: "ENABLED"})
+}
+
+func TestPlanNoOp(t *testing.T) {
+	p, sources := GetPlanner(nil, &db.Item{S3ObjectKey: "policies/" + test.PolicyExampleFileName, PolicyId: "test-id"})
+
+	changes, err := p.Plan(sources, "policies/")
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, ActionNoOp, changes[0].Action)
+	assert.Empty(t, changes[0].Diffs)
+}
+
+func TestPlanUpdate(t *testing.T) {
+	p, sources := GetPlanner(
+		map[string]string{"state": "DISABLED"},
+		&db.Item{S3ObjectKey: "policies/" + test.PolicyExampleFileName, PolicyId: "test-id"},
+	)
+
+	changes, err := p.Plan(sources, "policies/")
+	assert.NoError(t, err)
+	assert.Equal(t, ActionUpdate, changes[0].Action)
+	assert.Equal(t, []FieldDiff{{Field: "State", Old: "DISABLED", New: "ENABLED"}}, changes[0].Diffs)
+}
+
+func TestPlanDelete(t *testing.T) {
+	p, sources := GetPlanner(
+		map[string]string{"missing": "yes"},
+		&db.Item{S3ObjectKey: "policies/gone.yaml", PolicyId: "gone-id", Hash: "gone"},
+		&db.Item{S3ObjectKey: "elsewhere/kept.yaml", PolicyId: "kept-id"},
+		// Imported into a directory, the file isn't uploaded yet
+		&db.Item{S3ObjectKey: "policies/imported.yaml", PolicyId: "imported-id"},
+	)
+
+	changes, err := p.Plan(sources, "policies/")
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, ActionDelete, changes[0].Action)
+	assert.Equal(t, "policies/gone.yaml", changes[0].Key)
+	assert.Equal(t, "policy not found in DLM", changes[0].Note)
+}
+
+func TestWritePlan(t *testing.T) {
+	var b bytes.Buffer
+	WritePlan(&b, []*Change{
+		{Action: ActionUpdate, Key: "a.yaml", PolicyId: "a-id", Diffs: []FieldDiff{{Field: "State", Old: "DISABLED", New: "ENABLED"}}},
+		{Action: ActionNoOp, Key: "b.yaml", PolicyId: "b-id"},
+	})
+
+	assert.Equal(t, "~ update a.yaml (a-id)\n    ~ State: \"DISABLED\" -> \"ENABLED\"\n\nPlan: 0 to create, 1 to update, 0 to delete, 1 unchanged.\n", b.String())
+
+	b.Reset()
+	WritePlan(&b, nil)
+	assert.Equal(t, "No changes. 0 policy(ies) up to date.\n", b.String())
+
+	b.Reset()
+	WritePlan(&b, []*Change{{Action: ActionInvalid, Key: "README.md", Note: "Failed to parse"}})
+	assert.Equal(t, "! invalid README.md\n    # Failed to parse\n\nNo changes. 0 policy(ies) up to date. 1 invalid file(s) skipped.\n", b.String())
+}
@@ -3,32 +3,114 @@ package policy
 import (
 	"errors"
 	"fmt"
+	"log"
 	"regexp"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dlm"
 	"github.com/aws/aws-sdk-go/service/dlm/dlmiface"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
 
 	"github.com/liangrog/adlm-helper/dlm/db"
 	"github.com/liangrog/adlm-helper/dlm/file"
 )
 
+// Attempts of a record whose registry writes conflict
+const maxAttempts = 3
+
+// Log prefixes
+const (
+	msgPrefix   = "[ADLM-HELPER-INFO]"
+	warnPrefix  = "[ADLM-HELPER-WARN]"
+	errorPrefix = "[ADLM-HELPER-ERROR]"
+)
+
 // Item from handler given by triggered events
 type eventItem struct {
 	record  events.S3EventRecord
 	context lambdacontext.LambdaContext
 	dbItem  *db.Item
+	source  *file.Policy
+
+	// S3 version being rolled back to
+	rollbackVersion string
+
+	// Apply even if the input is unchanged
+	force bool
+
+	// Origin to record, empty for bucket events
+	origin string
+
+	// Record of the key, including tombstones
+	last *db.Item
+}
+
+// S3 event sequencer, padded to compare with records
+func (e *eventItem) sequencer() string {
+	return db.PadSequencer(e.record.S3.Object.Sequencer)
+}
+
+// Event time to record, empty if unknown
+func (e *eventItem) eventTime() string {
+	if e.record.EventTime.IsZero() {
+		return ""
+	}
+
+	return e.record.EventTime.UTC().Format(time.RFC3339Nano)
+}
+
+// If a later event of the key has been applied already,
+// or the same delete. S3 doesn't deliver events in order.
+// Other events are applied again when redelivered.
+func (e *eventItem) stale() bool {
+	s := e.sequencer()
+	if s == "" || e.last == nil {
+		return false
+	}
+
+	return e.last.Sequencer > s || (e.last.Sequencer == s && e.last.Deleted)
+}
+
+// Record the event before DLM is called, so an older
+// event processed concurrently can't be applied after
+// it. Fails with db.ErrOutOfOrder if a later event got
+// to the record first.
+func (e *eventItem) claim(conn db.DB) error {
+	if e.sequencer() == "" || e.dbItem == nil {
+		return nil
+	}
+
+	di := *e.dbItem
+	di.RequestId = e.context.AwsRequestID
+	di.Sequencer = e.sequencer()
+	di.EventTime = e.eventTime()
+
+	if err := conn.Update(&di); err != nil {
+		return err
+	}
+
+	*e.dbItem = di
+
+	return nil
 }
 
 // AWS services client
 type AwsClients struct {
+	S3           s3iface.S3API
 	S3Downloader s3manageriface.DownloaderAPI
+	S3Uploader   s3manageriface.UploaderAPI
 	Dynamodb     dynamodbiface.DynamoDBAPI
 	Dlm          dlmiface.DLMAPI
+	Iam          iamiface.IAMAPI
+	Sns          snsiface.SNSAPI
 }
 
 // Policy entity.
@@ -37,6 +119,7 @@ type Policy struct {
 	client *AwsClients
 	item   *eventItem
 	dbconn db.DB
+	config *Config
 }
 
 // Set AWS client
@@ -46,6 +129,25 @@ func (p *Policy) SetClients(c *AwsClients) {
 	p.dbconn = db.GetConn(p.client.Dynamodb)
 }
 
+// Get AWS client
+func (p *Policy) Clients() *AwsClients {
+	return p.client
+}
+
+// Set processors configuration
+func (p *Policy) SetConfig(c *Config) {
+	p.config = c
+}
+
+// Get processors configuration
+func (p *Policy) Config() *Config {
+	if p.config == nil {
+		return DefaultConfig()
+	}
+
+	return p.config
+}
+
 // Set DB Conn
 func (p *Policy) SetDBConn(c db.DB) {
 	p.dbconn = db.GetConn(c)
@@ -58,21 +160,57 @@ func (p *Policy) SetPolicy(r events.S3EventRecord, c lambdacontext.LambdaContext
 		context: c,
 	}
 
-	// Proactive checking if policy exist
-	if di, err := p.dbconn.FindByKey(p.item.record.S3.Object.Key); err != nil {
+	return p.reload()
+}
+
+// Read the record of the key.
+// Tombstones of deleted files only order events.
+func (p *Policy) reload() error {
+	di, err := p.dbconn.FindByKey(p.item.record.S3.Object.Key)
+	if err != nil {
 		return err
-	} else if di != nil {
+	}
+
+	p.item.last = di
+	p.item.dbItem = nil
+	if di != nil && !di.Deleted {
 		p.item.dbItem = di
-	} else {
-		p.item.dbItem = nil
 	}
 
 	return nil
 }
 
+// Run the processor of the record. Registry writes
+// conflicting with a concurrent invocation are retried
+// with the reloaded record, unless that invocation
+// applied a later event.
+func (p *Policy) execute() error {
+	for attempt := 1; ; attempt++ {
+		err := p.Dispatch().Execute()
+		if !db.IsConflict(err) || attempt == maxAttempts {
+			return err
+		}
+
+		log.Println(fmt.Sprintf("%s %v, retrying", warnPrefix, err))
+
+		if err = p.reload(); err != nil {
+			return err
+		}
+
+		if p.item.stale() {
+			log.Println(fmt.Sprintf("%s Dropping event triggered by %s because a later event has been applied", msgPrefix, p.item.record.S3.Object.Key))
+			return nil
+		}
+	}
+}
+
 // Decide what to do with a given s3 event record.
 // It returns the processor for invoking
 func (p *Policy) Dispatch() Processor {
+	if p.config == nil {
+		p.config = DefaultConfig()
+	}
+
 	// If EventName start with ObjectRemoved, it indicates it's a delete event
 	if re := regexp.MustCompile(`^ObjectRemoved`); re.MatchString(p.item.record.EventName) {
 		return Deleter{
@@ -87,6 +225,7 @@ func (p *Policy) Dispatch() Processor {
 		item:   p.item,
 		client: p.client,
 		dbconn: p.dbconn,
+		config: p.config,
 	}
 }
 
@@ -104,6 +243,7 @@ type Upserter struct {
 	item   *eventItem
 	client *AwsClients
 	dbconn db.DB
+	config *Config
 }
 
 func (u Upserter) Execute() error {
@@ -111,105 +251,202 @@ func (u Upserter) Execute() error {
 		return u.CreatePolicy()
 	}
 
+	if u.item.dbItem.IsPending() {
+		return u.ResumeCreate()
+	}
+
 	return u.UpdatePolicy()
 }
 
-// Populate the input from records.
-// The return value can be create input or update input depends on the event.
-func (u Upserter) hydrate() (interface{}, error) {
-	// Load policy config from s3
+// Load policy config from s3.
+// It's only downloaded once per event.
+func (u Upserter) load() (*file.Policy, error) {
+	if u.item.source != nil {
+		return u.item.source, nil
+	}
+
 	f, err := file.UnmarshalPolicyFromS3(u.item.record, u.client.S3Downloader)
 	if err != nil {
 		return nil, err
 	}
 
-	// Retain Rule
-	retainRule := new(dlm.RetainRule).
-		SetCount(f.PolicyDetails.Schedules[0].RetainRule.Count)
+	u.item.source = f
 
-	// Create Rule
-	createRule := new(dlm.CreateRule).
-		SetInterval(f.PolicyDetails.Schedules[0].CreateRule.Interval).
-		SetIntervalUnit(f.PolicyDetails.Schedules[0].CreateRule.IntervalUnit).
-		SetTimes(f.PolicyDetails.Schedules[0].CreateRule.Times)
+	return f, nil
+}
 
-	// Schedules
-	var tagsToAdd []*dlm.Tag
-	for _, t := range f.PolicyDetails.Schedules[0].TagsToAdd {
-		tagsToAdd = append(tagsToAdd, &dlm.Tag{Key: aws.String(t.Key), Value: aws.String(t.Value)})
+// Checks to pass before calling DLM
+func (u Upserter) preflight(details *dlm.PolicyDetails) error {
+	f, err := u.load()
+	if err != nil {
+		return err
 	}
 
-	schedule := new(dlm.Schedule).
-		SetName(f.PolicyDetails.Schedules[0].Name).
-		SetCreateRule(createRule).
-		SetRetainRule(retainRule).
-		SetTagsToAdd(tagsToAdd)
+	if err = u.checkGuardrails(f); err != nil {
+		return err
+	}
 
-	// PolicyDetails
-	var targetTags []*dlm.Tag
-	for _, t := range f.PolicyDetails.TargetTags {
-		targetTags = append(targetTags, &dlm.Tag{Key: aws.String(t.Key), Value: aws.String(t.Value)})
+	if err = u.checkRules(f); err != nil {
+		return err
 	}
 
-	policyDetails := new(dlm.PolicyDetails).
-		SetResourceTypes([]*string{aws.String(f.PolicyDetails.ResourceTypes)}).
-		SetSchedules([]*dlm.Schedule{schedule}).
-		SetTargetTags(targetTags)
+	if err = u.checkExecutionRole(f.ExecutionRoleArn); err != nil {
+		return err
+	}
+
+	return u.checkTagConflicts(details.TargetTags)
+}
+
+// Populate the input from records.
+// The return value can be create input or update input depends on the event.
+func (u Upserter) hydrate() (interface{}, error) {
+	f, err := u.load()
+	if err != nil {
+		return nil, err
+	}
 
 	// If it's update
-	if u.item.dbItem != nil {
-		return new(dlm.UpdateLifecyclePolicyInput).
-				SetDescription(f.Description).
-				SetExecutionRoleArn(f.ExecutionRoleArn).
-				SetPolicyDetails(policyDetails).
-				SetState(f.State).
-				SetPolicyId(u.item.dbItem.PolicyId),
-			nil
+	if u.item.dbItem != nil && !u.item.dbItem.IsPending() {
+		return NewUpdateInput(f, u.item.dbItem.PolicyId)
 	}
 
 	// If it's create
-	return new(dlm.CreateLifecyclePolicyInput).
-			SetDescription(f.Description).
-			SetExecutionRoleArn(f.ExecutionRoleArn).
-			SetPolicyDetails(policyDetails).
-			SetState(f.State),
-		nil
+	return newTaggedCreateInput(f, u.item.record)
+}
+
+// Log the input sent to DLM when debugging
+func (u Upserter) debug(input interface{}) {
+	if u.config == nil || !u.config.Debug {
+		return
+	}
+
+	raw, err := RenderInput(input)
+	if err != nil {
+		log.Println(fmt.Sprintf("%s Failed to render input of %s: %v", warnPrefix, u.item.record.S3.Object.Key, err))
+		return
+	}
+
+	log.Println(fmt.Sprintf("%s Input of %s: %s", msgPrefix, u.item.record.S3.Object.Key, raw))
 }
 
-// Create DLM polocy and save the result into database
+// Create input of a policy file tagged with the
+// provenance of the object it was read from
+func newTaggedCreateInput(f *file.Policy, r events.S3EventRecord) (*dlm.CreateLifecyclePolicyInput, error) {
+	input, err := NewCreateInput(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return input.SetTags(provenanceTags(r)), nil
+}
+
+// Tag the create input with the client token of
+// its pending record
+func setClientToken(input *dlm.CreateLifecyclePolicyInput, token string) {
+	input.Tags[TagToken] = aws.String(token)
+}
+
+// Create DLM polocy and save the result into database.
+// A pending record is written first, so a create that
+// doesn't get to save its result is resumed by retries
+// instead of creating a second policy.
 func (u Upserter) CreatePolicy() error {
-	var input *dlm.CreateLifecyclePolicyInput
+	input, hash, err := u.createInput()
+	if err != nil {
+		return err
+	}
 
-	i, err := u.hydrate()
+	token, err := newClientToken()
 	if err != nil {
 		return err
 	}
 
+	pending := &db.Item{
+		S3ObjectKey:  u.item.record.S3.Object.Key,
+		RequestId:    u.item.context.AwsRequestID,
+		CreatedAt:    fmt.Sprintf("%s", u.item.record.EventTime),
+		UpdatedAt:    fmt.Sprintf("%s", u.item.record.EventTime),
+		Sequencer:    u.item.sequencer(),
+		EventTime:    u.item.eventTime(),
+		State:        db.StatePending,
+		ClientToken:  token,
+		PendingSince: time.Now().UTC().Format(time.RFC3339),
+		Origin:       u.item.origin,
+	}
+
+	if err = u.dbconn.Create(pending); err != nil {
+		return err
+	}
+
+	return u.create(input, hash, pending)
+}
+
+// Checked create input and its hash
+func (u Upserter) createInput() (*dlm.CreateLifecyclePolicyInput, string, error) {
+	i, err := u.hydrate()
+	if err != nil {
+		return nil, "", err
+	}
+
 	input, ok := i.(*dlm.CreateLifecyclePolicyInput)
 	if !ok {
-		return errors.New("Failed to cast data into CreateLifecyclePolicyInput")
+		return nil, "", errors.New("Failed to cast data into CreateLifecyclePolicyInput")
 	}
 
+	if err = u.preflight(input.PolicyDetails); err != nil {
+		return nil, "", err
+	}
+
+	hash, err := InputHash(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return input, hash, nil
+}
+
+// Create the policy of a pending record, tagged with
+// its client token, and commit the record
+func (u Upserter) create(input *dlm.CreateLifecyclePolicyInput, hash string, pending *db.Item) error {
+	setClientToken(input, pending.ClientToken)
+	u.debug(input)
+
 	// Create policy
 	output, err := u.client.Dlm.CreateLifecyclePolicy(input)
 	if err != nil {
+		// Rejected inputs create nothing. Other errors, e.g.
+		// timeouts, might have, so the record is kept to resume.
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dlm.ErrCodeInvalidRequestException {
+			if derr := u.dbconn.Delete(pending); derr != nil {
+				log.Println(fmt.Sprintf("%s Failed to delete pending record of %s: %v", warnPrefix, pending.S3ObjectKey, derr))
+			}
+		}
+
 		return err
 	}
 
-	// Save to database
+	return u.commit(pending, aws.StringValue(output.PolicyId), hash)
+}
+
+// Save the created policy to the pending record
+func (u Upserter) commit(pending *db.Item, policyId, hash string) error {
 	di := &db.Item{
 		S3ObjectKey: u.item.record.S3.Object.Key,
-		PolicyId:    *output.PolicyId,
+		PolicyId:    policyId,
 		RequestId:   u.item.context.AwsRequestID,
-		CreatedAt:   fmt.Sprintf("%s", u.item.record.EventTime),
+		CreatedAt:   pending.CreatedAt,
 		UpdatedAt:   fmt.Sprintf("%s", u.item.record.EventTime),
+		Hash:        hash,
+		Sequencer:   u.item.sequencer(),
+		EventTime:   u.item.eventTime(),
+		Version:     pending.Version,
+
+		RollbackVersion: u.item.rollbackVersion,
+		ObjectVersion:   u.item.record.S3.Object.VersionID,
+		Origin:          u.item.origin,
 	}
 
-	if err = u.dbconn.Create(di); err != nil {
-		return err
-	}
-
-	return nil
+	return u.dbconn.Update(di)
 }
 
 // Update exsiting policy and related database record
@@ -226,8 +463,46 @@ func (u Upserter) UpdatePolicy() error {
 		return errors.New("Failed to cast data into UpdateLifecyclePolicyInput")
 	}
 
-	// Update policy
+	hash, err := InputHash(input)
+	if err != nil {
+		return err
+	}
+
+	// Checks can be tightened after the input was applied,
+	// so they gate unchanged inputs too
+	if err = u.preflight(input.PolicyDetails); err != nil {
+		return err
+	}
+
+	// Nothing to do if the same input was applied last,
+	// e.g. only comments of the file changed, unless the
+	// policy was deleted outside its file. Finding out
+	// takes a read of the policy, it isn't updated.
+	if !u.item.force && hash == u.item.dbItem.Hash {
+		exists, err := u.exists()
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			log.Println(fmt.Sprintf("%s Policy file %s is unchanged, skipped update of %s", msgPrefix, u.item.record.S3.Object.Key, u.item.dbItem.PolicyId))
+			return u.advance()
+		}
+	}
+
+	if err = u.item.claim(u.dbconn); err != nil {
+		return err
+	}
+
+	u.debug(input)
+
+	// Update policy. Recreate it if it was deleted
+	// outside its file, so the file is applied again.
 	_, err = u.client.Dlm.UpdateLifecyclePolicy(input)
+	if notFound(err) {
+		return u.recreate(hash)
+	}
+
 	if err != nil {
 		return err
 	}
@@ -239,6 +514,14 @@ func (u Upserter) UpdatePolicy() error {
 		RequestId:   u.item.context.AwsRequestID,
 		CreatedAt:   u.item.dbItem.CreatedAt,
 		UpdatedAt:   fmt.Sprintf("%s", u.item.record.EventTime),
+		Hash:        hash,
+		Sequencer:   u.item.sequencer(),
+		EventTime:   u.item.eventTime(),
+		Version:     u.item.dbItem.Version,
+
+		RollbackVersion: u.item.rollbackVersion,
+		ObjectVersion:   u.item.record.S3.Object.VersionID,
+		Origin:          u.item.origin,
 	}
 
 	if err = u.dbconn.Update(di); err != nil {
@@ -248,6 +531,100 @@ func (u Upserter) UpdatePolicy() error {
 	return nil
 }
 
+// Record the event of a skipped update, so that
+// older events delivered later are still ignored and
+// the record names the object version applied. An
+// unchanged upload ends a rollback like an update.
+func (u Upserter) advance() error {
+	di := *u.item.dbItem
+	if s := u.item.sequencer(); s != "" {
+		di.Sequencer, di.EventTime = s, u.item.eventTime()
+	}
+
+	if v := u.item.record.S3.Object.VersionID; v != "" {
+		di.ObjectVersion = v
+	}
+
+	di.RollbackVersion = u.item.rollbackVersion
+	di.Origin = u.item.origin
+	if di == *u.item.dbItem {
+		return nil
+	}
+
+	return u.dbconn.Update(&di)
+}
+
+// Whether the recorded policy exists in DLM
+func (u Upserter) exists() (bool, error) {
+	_, err := u.client.Dlm.GetLifecyclePolicy(&dlm.GetLifecyclePolicyInput{
+		PolicyId: aws.String(u.item.dbItem.PolicyId),
+	})
+
+	if notFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Create a replacement of the recorded policy that
+// no longer exists in DLM. The record is made pending
+// first, like the one of a new file.
+func (u Upserter) recreate(hash string) error {
+	f, err := u.load()
+	if err != nil {
+		return err
+	}
+
+	input, err := newTaggedCreateInput(f, u.item.record)
+	if err != nil {
+		return err
+	}
+
+	token, err := newClientToken()
+	if err != nil {
+		return err
+	}
+
+	pending := *u.item.dbItem
+	pending.RequestId = u.item.context.AwsRequestID
+	pending.State = db.StatePending
+	pending.ClientToken = token
+	pending.PendingSince = time.Now().UTC().Format(time.RFC3339)
+
+	if err = u.dbconn.Update(&pending); err != nil {
+		return err
+	}
+
+	log.Println(fmt.Sprintf("%s Policy %s of %s no longer exists in DLM, creating a replacement", warnPrefix, u.item.dbItem.PolicyId, u.item.record.S3.Object.Key))
+
+	return u.create(input, hash, &pending)
+}
+
+// Record to delete, at the version it was read.
+// It's kept as a tombstone if the event has a sequencer.
+func (d Deleter) tombstone() *db.Item {
+	di := &db.Item{
+		S3ObjectKey: d.item.record.S3.Object.Key,
+		RequestId:   d.item.context.AwsRequestID,
+		UpdatedAt:   fmt.Sprintf("%s", d.item.record.EventTime),
+		Sequencer:   d.item.sequencer(),
+		EventTime:   d.item.eventTime(),
+	}
+
+	if d.item.last != nil {
+		di.Version = d.item.last.Version
+	}
+
+	return di
+}
+
+// Whether the error is DLM's policy not found
+func notFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dlm.ErrCodeResourceNotFoundException
+}
+
 // Policy deleter
 type Deleter struct {
 	item   *eventItem
@@ -263,7 +640,15 @@ func (d Deleter) Execute() error {
 // Delete policy from DLM and related database record
 func (d Deleter) DeletePolicy() error {
 	if d.item.dbItem == nil {
-		return fmt.Errorf("Failed to delete. No record has been found in database for policy %s", d.item.record.S3.Object.Key)
+		return d.deleteUnrecorded()
+	}
+
+	if d.item.dbItem.IsPending() {
+		return d.deletePending()
+	}
+
+	if err := d.item.claim(d.dbconn); err != nil {
+		return err
 	}
 
 	input := &dlm.DeleteLifecyclePolicyInput{
@@ -277,7 +662,7 @@ func (d Deleter) DeletePolicy() error {
 	}
 
 	// Delete from database
-	if err = d.dbconn.Delete(d.item.dbItem); err != nil {
+	if err = d.dbconn.Delete(d.tombstone()); err != nil {
 		return err
 	}
 
@@ -1,15 +1,20 @@
 package policy
 
 import (
+	"errors"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dlm"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/file"
+	"github.com/liangrog/adlm-helper/dlm/local"
 	"github.com/liangrog/adlm-helper/dlm/test"
 )
 
@@ -141,3 +146,239 @@ func TestDeletePolicy(t *testing.T) {
 	err := deleter.DeletePolicy()
 	assert.NoError(t, err)
 }
+
+// Upserter whose target tags are also targeted by other.yaml
+func GetConflictingUpserter(mode string) Upserter {
+	record.EventName = "ObjectCreated:Put"
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: new(test.MockDownloader),
+		Dynamodb: &test.MockDynamoDB{
+			Payload: map[string]string{
+				"scan": "yes",
+			},
+		},
+		Dlm: &test.MockDlm{
+			Payload: map[string]string{
+				"policies": "other-id",
+			},
+		},
+	})
+	p.SetConfig(&Config{TagConflict: mode})
+	p.SetPolicy(record, context)
+
+	return p.Dispatch().(Upserter)
+}
+
+func TestCreatePolicyTagConflictReject(t *testing.T) {
+	err := GetConflictingUpserter(ConflictReject).CreatePolicy()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "other.yaml")
+}
+
+func TestCreatePolicyTagConflictPending(t *testing.T) {
+	f, err := file.UnmarshalPolicyFromS3(record, new(test.MockDownloader))
+	assert.NoError(t, err)
+	input, err := NewCreateInput(f)
+	assert.NoError(t, err)
+
+	// The create of other.yaml didn't commit its policy yet
+	d := local.NewDlm()
+	d.CreateLifecyclePolicy(input.SetTags(map[string]*string{TagToken: aws.String("other-token")}))
+
+	u := GetConflictingUpserter(ConflictReject)
+	u.client.Dlm = d
+	u.dbconn = db.NewMemory(&db.Item{S3ObjectKey: "other.yaml", State: db.StatePending, ClientToken: "other-token"})
+
+	err = u.CreatePolicy()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "other.yaml")
+}
+
+func TestCreatePolicyTagConflictWarn(t *testing.T) {
+	err := GetConflictingUpserter(ConflictWarn).CreatePolicy()
+	assert.NoError(t, err)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	os.Setenv(EnvTagConflict, ConflictWarn)
+	defer os.Unsetenv(EnvTagConflict)
+
+	c, err := ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, ConflictWarn, c.TagConflict)
+	assert.Equal(t, DriftAlert, c.DriftAction)
+
+	os.Setenv(EnvTagConflict, "maybe")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestConfigFromEnvDebug(t *testing.T) {
+	os.Setenv(EnvDebug, "true")
+	defer os.Unsetenv(EnvDebug)
+
+	c, err := ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.True(t, c.Debug)
+
+	os.Setenv(EnvDebug, "loud")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestIsPolicyBucket(t *testing.T) {
+	c := DefaultConfig()
+	c.Bucket = "policies"
+
+	assert.True(t, c.IsPolicyBucket("policies"))
+	assert.True(t, c.IsPolicyBucket("123456789101-adlm-helper"))
+	assert.False(t, c.IsPolicyBucket("exports"))
+	assert.False(t, c.IsPolicyBucket(""))
+}
+
+func TestUpdatePolicyRecreate(t *testing.T) {
+	record.EventName = "ObjectCreated:Put"
+	conn := db.NewMemory(&db.Item{S3ObjectKey: test.PolicyExampleFileName, PolicyId: "gone-id", CreatedAt: "1900-00-00 00:00:00"})
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: new(test.MockDownloader),
+		Dlm:          &test.MockDlm{Payload: map[string]string{"missing": "yes"}},
+	})
+	p.SetDBConn(conn)
+	p.SetPolicy(record, context)
+
+	assert.NoError(t, p.Dispatch().Execute())
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-id", di.PolicyId)
+	assert.Equal(t, "1900-00-00 00:00:00", di.CreatedAt)
+}
+
+func TestUpdatePolicyUnchanged(t *testing.T) {
+	record.EventName = "ObjectCreated:Put"
+
+	f, err := file.UnmarshalPolicyFromS3(record, new(test.MockDownloader))
+	assert.NoError(t, err)
+	input, err := NewUpdateInput(f, "test-id")
+	assert.NoError(t, err)
+	hash, err := InputHash(input)
+	assert.NoError(t, err)
+
+	conn := db.NewMemory(&db.Item{S3ObjectKey: test.PolicyExampleFileName, PolicyId: "test-id", UpdatedAt: "1900-00-00 00:00:00", Hash: hash})
+
+	mock := new(test.MockDlm)
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: new(test.MockDownloader),
+		Dlm:          mock,
+	})
+	p.SetDBConn(conn)
+	p.SetPolicy(record, context)
+
+	assert.NoError(t, p.Dispatch().Execute())
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "1900-00-00 00:00:00", di.UpdatedAt)
+
+	// Forced updates go through, DLM fails when it's called
+	mock.Err = errors.New("called")
+	p.SetPolicy(record, context)
+	p.item.force = true
+	assert.Error(t, p.Dispatch().Execute())
+
+	// Policies deleted outside their file are recreated
+	mock.Err = nil
+	mock.Payload = map[string]string{"missing": "yes"}
+	p.SetPolicy(record, context)
+	assert.NoError(t, p.Dispatch().Execute())
+
+	di, err = conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "1900-00-00 00:00:00", di.UpdatedAt)
+}
+
+func TestUpdatePolicyUnchangedTightened(t *testing.T) {
+	record.EventName = "ObjectCreated:Put"
+
+	f, err := file.UnmarshalPolicyFromS3(record, new(test.MockDownloader))
+	assert.NoError(t, err)
+	input, err := NewUpdateInput(f, "test-id")
+	assert.NoError(t, err)
+	hash, err := InputHash(input)
+	assert.NoError(t, err)
+
+	conn := db.NewMemory(&db.Item{S3ObjectKey: test.PolicyExampleFileName, PolicyId: "test-id", UpdatedAt: "1900-00-00 00:00:00", Hash: hash})
+
+	// Guardrails tightened since the input was applied
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: &test.MockDownloader{
+			Objects: map[string]string{
+				GuardrailsKey: "MinRetention: 14",
+			},
+		},
+		Dlm: new(test.MockDlm),
+	})
+	p.SetDBConn(conn)
+	p.SetPolicy(record, context)
+
+	err = p.Dispatch().Execute()
+	assert.IsType(t, &GuardrailError{}, err)
+
+	// The record isn't written
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), di.Version)
+}
+
+// Registry where another invocation writes the
+// record right before the first update
+type racingDB struct {
+	*db.Memory
+	raced bool
+}
+
+func (r *racingDB) Update(i *db.Item) error {
+	if !r.raced {
+		r.raced = true
+
+		other := *i
+		other.RequestId, other.Hash = "other", "other"
+		if err := r.Memory.Update(&other); err != nil {
+			return err
+		}
+	}
+
+	return r.Memory.Update(i)
+}
+
+func TestExecuteRetriesConflict(t *testing.T) {
+	record.EventName = "ObjectCreated:Put"
+	conn := &racingDB{Memory: db.NewMemory(&db.Item{S3ObjectKey: test.PolicyExampleFileName, PolicyId: "test-id"})}
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: new(test.MockDownloader),
+		Dlm:          new(test.MockDlm),
+	})
+	p.SetDBConn(conn)
+	p.SetPolicy(record, context)
+
+	// The processor alone gives up
+	err := p.Dispatch().Execute()
+	assert.True(t, db.IsConflict(err))
+
+	conn.raced = false
+	p.SetPolicy(record, context)
+	assert.NoError(t, p.execute())
+
+	di, err := conn.FindByKey(test.PolicyExampleFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, context.AwsRequestID, di.RequestId)
+	assert.Equal(t, int64(3), di.Version)
+}
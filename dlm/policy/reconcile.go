@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// Outcome of a reconciliation run
+type ReconcileReport struct {
+	Created   int
+	Updated   int
+	Deleted   int
+	Unchanged int
+	Failed    int
+
+	// Objects skipped as they aren't valid policy files
+	Invalid int
+
+	// Updates alerted as drift instead of applied
+	Drifted int
+
+	// Planned changes when the run was stopped by the cap
+	Planned int
+	Capped  bool
+}
+
+func (r *ReconcileReport) String() string {
+	if r.Capped {
+		return fmt.Sprintf("Reconciliation stopped, %d changes planned exceed the maximum. Nothing changed", r.Planned)
+	}
+
+	return fmt.Sprintf("Reconciled: %d created, %d updated, %d deleted, %d unchanged, %d drifted, %d failed, %d invalid",
+		r.Created, r.Updated, r.Deleted, r.Unchanged, r.Drifted, r.Failed, r.Invalid)
+}
+
+// Reconcile converges DLM and the registry with the
+// policy objects of the bucket: missing policies are
+// created, changed ones updated and orphans deleted.
+// Nothing is changed if more changes than the maximum
+// are planned, e.g. when the bucket was emptied by
+// accident. It repairs lost or failed S3 events.
+// Files changed since they were last applied are
+// always updated. Live policies differing from an
+// unchanged file are drift, which is only alerted
+// if drift is configured to be.
+// Stale pending creates are resolved beforehand.
+// Rollbacks are kept, objects that aren't valid
+// policy files are skipped and reported.
+func (p *Policy) Reconcile(bucket string, max int, c lambdacontext.LambdaContext) (*ReconcileReport, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("Failed to reconcile. %s is not set", EnvBucket)
+	}
+
+	if p.config == nil {
+		p.config = DefaultConfig()
+	}
+
+	// Creates that never committed are resolved first
+	if _, err := p.SweepPending(PendingTimeout); err != nil {
+		return nil, err
+	}
+
+	changes, err := p.PlanBucket(bucket, "")
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(ReconcileReport)
+	for _, change := range changes {
+		switch change.Action {
+		case ActionNoOp:
+			report.Unchanged++
+		case ActionInvalid:
+			report.Invalid++
+			log.Println(fmt.Sprintf("%s Skipping %s: %s", errorPrefix, change.Key, change.Note))
+		default:
+			report.Planned++
+		}
+	}
+
+	if report.Planned > max {
+		report.Capped = true
+		for _, change := range changes {
+			if change.Action != ActionNoOp && change.Action != ActionInvalid {
+				log.Println(fmt.Sprintf("%s Planned %s of %s", warnPrefix, change.Action, change.Key))
+			}
+		}
+
+		return report, errors.New(report.String())
+	}
+
+	var drifts []*Drift
+	for _, change := range changes {
+		if change.Action == ActionNoOp || change.Action == ActionInvalid {
+			continue
+		}
+
+		if drift := driftOf(change); drift != nil && p.config.DriftAction == DriftAlert {
+			drifts = append(drifts, drift)
+			continue
+		}
+
+		if err := p.applyChange(change, bucket, c); err != nil {
+			report.Failed++
+			log.Println(fmt.Sprintf("%s Failed to %s %s: %v", errorPrefix, change.Action, change.Key, err))
+			continue
+		}
+
+		log.Println(fmt.Sprintf("%s Reconciled %s of %s", msgPrefix, change.Action, change.Key))
+
+		switch change.Action {
+		case ActionCreate:
+			report.Created++
+		case ActionUpdate:
+			report.Updated++
+		case ActionDelete:
+			report.Deleted++
+		}
+	}
+
+	report.Drifted = len(drifts)
+	if err := NewDriftDetector(p, bucket).Respond(drifts, c); err != nil {
+		log.Println(fmt.Sprintf("%s %v", errorPrefix, err))
+	}
+
+	log.Println(fmt.Sprintf("%s %s", msgPrefix, report))
+
+	if report.Failed > 0 {
+		return report, errors.New(report.String())
+	}
+
+	return report, nil
+}
@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+// Bucket with two new policies and a registry with an orphan
+func GetReconciler() (*Policy, *db.Memory) {
+	conn := db.NewMemory(&db.Item{S3ObjectKey: "gone.yaml", PolicyId: "gone-id", Hash: "gone"})
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3:           &test.MockS3{Payload: map[string]string{"objects": "a.yaml,b.yaml,_rules.yaml,dir/"}},
+		S3Downloader: new(test.MockDownloader),
+		Dlm:          new(test.MockDlm),
+	})
+	p.SetDBConn(conn)
+	p.SetConfig(DefaultConfig())
+
+	return p, conn
+}
+
+func TestReconcile(t *testing.T) {
+	p, conn := GetReconciler()
+
+	report, err := p.Reconcile("dummy-bucket", DefaultMaxChanges, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, &ReconcileReport{Created: 2, Deleted: 1, Planned: 3}, report)
+
+	items, err := conn.All()
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "a.yaml", items[0].S3ObjectKey)
+}
+
+func TestReconcileCapped(t *testing.T) {
+	p, conn := GetReconciler()
+
+	report, err := p.Reconcile("dummy-bucket", 2, lambdacontext.LambdaContext{})
+	assert.Error(t, err)
+	assert.True(t, report.Capped)
+
+	// Nothing changed
+	items, err := conn.All()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+func TestReconcileInvalid(t *testing.T) {
+	p, conn := GetReconciler()
+	p.Clients().S3Downloader = &test.MockDownloader{Objects: map[string]string{"b.yaml": "# not a policy\nState: ["}}
+
+	report, err := p.Reconcile("dummy-bucket", DefaultMaxChanges, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, &ReconcileReport{Created: 1, Deleted: 1, Invalid: 1, Planned: 2}, report)
+
+	items, err := conn.All()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+func TestReconcileKeepsRollback(t *testing.T) {
+	raw, err := ioutil.ReadFile(test.SrcTestFile)
+	assert.NoError(t, err)
+
+	p, conn := GetReconciler()
+	conn.Create(&db.Item{S3ObjectKey: "a.yaml", PolicyId: "test-id", Hash: "latest", RollbackVersion: "v1"})
+
+	// The latest version differs from the live policy, the
+	// version rolled back to doesn't
+	p.Clients().S3Downloader = &test.MockDownloader{Objects: map[string]string{
+		"a.yaml": strings.Replace(string(raw), "State: ENABLED", "State: DISABLED", 1),
+	}}
+
+	report, err := p.Reconcile("dummy-bucket", DefaultMaxChanges, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, &ReconcileReport{Created: 1, Deleted: 1, Unchanged: 1, Planned: 2}, report)
+
+	di, err := conn.FindByKey("a.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", di.RollbackVersion)
+}
+
+func TestReconcileKeepsApplied(t *testing.T) {
+	p, conn := GetReconciler()
+	conn.Create(&db.Item{S3ObjectKey: "applied.yaml", PolicyId: "applied-id", Hash: "applied", Origin: db.OriginLocal})
+
+	// Only the orphan of the bucket is deleted
+	report, err := p.Reconcile("dummy-bucket", DefaultMaxChanges, lambdacontext.LambdaContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, &ReconcileReport{Created: 2, Deleted: 1, Planned: 3}, report)
+
+	di, err := conn.FindByKey("applied.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "applied-id", di.PolicyId)
+}
+
+func TestReconcileWithoutBucket(t *testing.T) {
+	p, _ := GetReconciler()
+
+	_, err := p.Reconcile("", DefaultMaxChanges, lambdacontext.LambdaContext{})
+	assert.Error(t, err)
+}
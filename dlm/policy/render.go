@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dlm"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Client token tag value of rendered inputs. The real
+// token is random and only known when creating.
+const RenderedToken = "<client token>"
+
+// Render the DLM create input of a policy file as JSON.
+// It's the input the handler sends for the object of the
+// bucket and key, provenance tags included. The client
+// token is a placeholder, see RenderedToken.
+func Render(f *file.Policy, bucket, key string) ([]byte, error) {
+	var r events.S3EventRecord
+	r.S3.Bucket.Name = bucket
+	r.S3.Object.Key = key
+
+	input, err := newTaggedCreateInput(f, r)
+	if err != nil {
+		return nil, err
+	}
+
+	setClientToken(input, RenderedToken)
+
+	return RenderInput(input)
+}
+
+// Render a DLM input as indented JSON.
+// Unset fields are left out.
+func RenderInput(input interface{}) ([]byte, error) {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err = json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(dropNulls(v), "", "  ")
+}
+
+// Remove null values from decoded JSON
+func dropNulls(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if e == nil {
+				delete(t, k)
+				continue
+			}
+
+			t[k] = dropNulls(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = dropNulls(e)
+		}
+	}
+
+	return v
+}
+
+// InputHash is the SHA-256 of the rendered content of a
+// create or update input. The policy id and tags are left
+// out, so a policy created and later updated from the same
+// file has the same hash.
+func InputHash(input interface{}) (string, error) {
+	var content *dlm.UpdateLifecyclePolicyInput
+	switch v := input.(type) {
+	case *dlm.CreateLifecyclePolicyInput:
+		content = &dlm.UpdateLifecyclePolicyInput{
+			Description:      v.Description,
+			ExecutionRoleArn: v.ExecutionRoleArn,
+			PolicyDetails:    v.PolicyDetails,
+			State:            v.State,
+		}
+	case *dlm.UpdateLifecyclePolicyInput:
+		c := *v
+		c.PolicyId = nil
+		content = &c
+	default:
+		return "", fmt.Errorf("Failed to hash input of type %T", input)
+	}
+
+	raw, err := RenderInput(content)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,61 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	sources, err := LoadLocalSources("../../testdata", "")
+	assert.NoError(t, err)
+
+	raw, err := Render(sources[0].Policy, "dummy-bucket", "policies/a.yaml")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "null")
+
+	var input map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &input))
+	assert.Equal(t, "ENABLED", input["State"])
+
+	// Tagged like the policies the handler creates
+	assert.Equal(t, map[string]interface{}{
+		TagManaged: "true",
+		TagKey:     "policies/a.yaml",
+		TagBucket:  "dummy-bucket",
+		TagToken:   RenderedToken,
+	}, input["Tags"])
+
+	schedule := input["PolicyDetails"].(map[string]interface{})["Schedules"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"Key": "SnapName", "Value": "Awesome Snapshot"}}, schedule["TagsToAdd"])
+	assert.Equal(t, []interface{}{"01:00"}, schedule["CreateRule"].(map[string]interface{})["Times"])
+}
+
+func TestInputHash(t *testing.T) {
+	sources, err := LoadLocalSources("../../testdata", "")
+	assert.NoError(t, err)
+
+	create, err := NewCreateInput(sources[0].Policy)
+	assert.NoError(t, err)
+	create.SetTags(map[string]*string{TagManaged: aws.String("true")})
+
+	update, err := NewUpdateInput(sources[0].Policy, "test-id")
+	assert.NoError(t, err)
+
+	a, err := InputHash(create)
+	assert.NoError(t, err)
+	b, err := InputHash(update)
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.Len(t, a, 64)
+
+	update.SetState("DISABLED")
+	c, err := InputHash(update)
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, c)
+
+	_, err = InputHash("input")
+	assert.Error(t, err)
+}
@@ -0,0 +1,261 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// Service principal that assumes the execution role
+const dlmPrincipal = "dlm.amazonaws.com"
+
+// Action the execution role needs and the resource it
+// is needed on
+type roleAction struct {
+	Action   string
+	Resource string
+}
+
+// Actions the execution role needs to manage volume
+// snapshots, scoped like the DLM default role
+var requiredRoleActions = []roleAction{
+	{"ec2:CreateSnapshot", "*"},
+	{"ec2:DeleteSnapshot", "*"},
+	{"ec2:DescribeVolumes", "*"},
+	{"ec2:DescribeSnapshots", "*"},
+	{"ec2:CreateTags", "arn:aws:ec2:*::snapshot/*"},
+}
+
+// Error returned when the execution role can't be used by DLM
+type RoleError struct {
+	Arn    string
+	Reason string
+}
+
+func (e *RoleError) Error() string {
+	return fmt.Sprintf("Execution role %s %s", e.Arn, e.Reason)
+}
+
+// Verify the execution role exists, trusts DLM and
+// is allowed to manage snapshots
+func VerifyExecutionRole(arn string, client iamiface.IAMAPI) error {
+	name, err := roleName(arn)
+	if err != nil {
+		return err
+	}
+
+	output, err := client.GetRole(&iam.GetRoleInput{
+		RoleName: aws.String(name),
+	})
+
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == iam.ErrCodeNoSuchEntityException {
+			return &RoleError{Arn: arn, Reason: "doesn't exist"}
+		}
+
+		return err
+	}
+
+	trusted, err := trustsService(aws.StringValue(output.Role.AssumeRolePolicyDocument), dlmPrincipal)
+	if err != nil {
+		return fmt.Errorf("Failed to read trust policy of execution role %s: %v", arn, err)
+	}
+
+	if !trusted {
+		return &RoleError{Arn: arn, Reason: fmt.Sprintf("doesn't trust %s", dlmPrincipal)}
+	}
+
+	denied, err := deniedActions(aws.StringValue(output.Role.Arn), requiredRoleActions, client)
+	if err != nil {
+		return err
+	}
+
+	if len(denied) > 0 {
+		return &RoleError{Arn: arn, Reason: fmt.Sprintf("isn't allowed to %s", strings.Join(denied, ", "))}
+	}
+
+	return nil
+}
+
+// Role name is the last segment of the role ARN
+// e.g. arn:aws:iam::123456789012:role/path/name
+func roleName(arn string) (string, error) {
+	i := strings.Index(arn, ":role/")
+	if i < 0 {
+		return "", &RoleError{Arn: arn, Reason: "is not a role ARN"}
+	}
+
+	parts := strings.Split(arn[i+len(":role/"):], "/")
+
+	return parts[len(parts)-1], nil
+}
+
+// Simulate the actions on their resources against the
+// role policies and return the ones that aren't allowed
+func deniedActions(arn string, actions []roleAction, client iamiface.IAMAPI) ([]string, error) {
+	var denied []string
+	for _, a := range actions {
+		d, err := simulate(arn, a, client)
+		if err != nil {
+			return nil, err
+		}
+
+		denied = append(denied, d...)
+	}
+
+	return denied, nil
+}
+
+// Simulate a single action on its resource
+func simulate(arn string, a roleAction, client iamiface.IAMAPI) ([]string, error) {
+	var denied []string
+
+	input := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(arn),
+		ActionNames:     aws.StringSlice([]string{a.Action}),
+		ResourceArns:    aws.StringSlice([]string{a.Resource}),
+	}
+
+	for {
+		output, err := client.SimulatePrincipalPolicy(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range output.EvaluationResults {
+			if aws.StringValue(r.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+				denied = append(denied, aws.StringValue(r.EvalActionName))
+			}
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+
+		input.Marker = output.Marker
+	}
+
+	return denied, nil
+}
+
+// IAM policy values can either be a single value or a list
+type oneOrMany []json.RawMessage
+
+func (o *oneOrMany) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '[' {
+		var list []json.RawMessage
+		if err := json.Unmarshal(b, &list); err != nil {
+			return err
+		}
+
+		*o = list
+		return nil
+	}
+
+	*o = oneOrMany{json.RawMessage(b)}
+	return nil
+}
+
+// Values as strings
+func (o oneOrMany) strings() []string {
+	var list []string
+	for _, raw := range o {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+// Subset of an IAM trust policy
+type trustPolicy struct {
+	Statement oneOrMany
+}
+
+type trustStatement struct {
+	Effect    string
+	Action    oneOrMany
+	Principal json.RawMessage
+}
+
+// If the url encoded trust policy lets the service assume the role
+func trustsService(document, service string) (bool, error) {
+	decoded, err := url.QueryUnescape(document)
+	if err != nil {
+		return false, err
+	}
+
+	p := new(trustPolicy)
+	if err = json.Unmarshal([]byte(decoded), p); err != nil {
+		return false, err
+	}
+
+	for _, raw := range p.Statement {
+		s := new(trustStatement)
+		if err = json.Unmarshal(raw, s); err != nil {
+			return false, err
+		}
+
+		if s.Effect != "Allow" || !allowsAssumeRole(s.Action.strings()) {
+			continue
+		}
+
+		if principalIncludes(s.Principal, service) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func allowsAssumeRole(actions []string) bool {
+	for _, a := range actions {
+		if a == "sts:AssumeRole" || a == "sts:*" || a == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Principal is either "*" or a map of principal types
+func principalIncludes(raw json.RawMessage, service string) bool {
+	var wildcard string
+	if json.Unmarshal(raw, &wildcard) == nil {
+		return wildcard == "*"
+	}
+
+	var principal struct {
+		Service oneOrMany
+	}
+
+	if json.Unmarshal(raw, &principal) != nil {
+		return false
+	}
+
+	for _, s := range principal.Service.strings() {
+		if s == service {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check the execution role before calling DLM.
+// Skipped when no IAM client is given.
+func (u Upserter) checkExecutionRole(arn string) error {
+	if u.client.Iam == nil {
+		return nil
+	}
+
+	return VerifyExecutionRole(arn, u.client.Iam)
+}
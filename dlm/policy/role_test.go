@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+const roleArn = "arn:aws:iam::123456789101:role/service-role/AWSDataLifecycleManagerDefaultRole"
+
+func TestVerifyExecutionRole(t *testing.T) {
+	assert.NoError(t, VerifyExecutionRole(roleArn, new(test.MockIam)))
+
+	// Tags are only needed on snapshots
+	iam := &test.MockIam{Payload: map[string]string{"scoped": "ec2:CreateTags=arn:aws:ec2:*::snapshot/*"}}
+	assert.NoError(t, VerifyExecutionRole(roleArn, iam))
+}
+
+func TestVerifyExecutionRoleFailures(t *testing.T) {
+	cases := map[string]map[string]string{
+		"doesn't exist":                                       {"missing": "yes"},
+		"doesn't trust dlm.amazonaws.com":                     {"trust": `{"Statement":{"Effect":"Allow","Principal":{"Service":["lambda.amazonaws.com"]},"Action":["sts:AssumeRole"]}}`},
+		"isn't allowed to ec2:DeleteSnapshot, ec2:CreateTags": {"denied": "ec2:DeleteSnapshot,ec2:CreateTags"},
+		"isn't allowed to ec2:DescribeVolumes":                {"scoped": "ec2:DescribeVolumes=arn:aws:ec2:*:*:volume/*"},
+	}
+
+	for reason, payload := range cases {
+		err := VerifyExecutionRole(roleArn, &test.MockIam{Payload: payload})
+		if assert.IsType(t, &RoleError{}, err, reason) {
+			assert.Equal(t, reason, err.(*RoleError).Reason)
+		}
+	}
+
+	err := VerifyExecutionRole("arn:aws:iam::123456789101:user/bob", new(test.MockIam))
+	assert.IsType(t, &RoleError{}, err)
+}
+
+func TestTrustsService(t *testing.T) {
+	trusted, err := trustsService(`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"sts:*"}]}`, dlmPrincipal)
+	assert.NoError(t, err)
+	assert.True(t, trusted)
+
+	trusted, err = trustsService(`{"Statement":[{"Effect":"Deny","Principal":{"Service":"dlm.amazonaws.com"},"Action":"sts:AssumeRole"}]}`, dlmPrincipal)
+	assert.NoError(t, err)
+	assert.False(t, trusted)
+
+	_, err = trustsService(`{not json`, dlmPrincipal)
+	assert.Error(t, err)
+}
+
+func TestCreatePolicyUntrustedRole(t *testing.T) {
+	record.EventName = "ObjectCreated:Put"
+
+	clients := GetClients(false)
+	clients.Iam = &test.MockIam{Payload: map[string]string{"missing": "yes"}}
+
+	p := new(Policy)
+	p.SetClients(clients)
+	p.SetPolicy(record, context)
+
+	err := p.Dispatch().(Upserter).CreatePolicy()
+	assert.IsType(t, &RoleError{}, err)
+}
@@ -0,0 +1,257 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"gopkg.in/yaml.v2"
+
+	"github.com/liangrog/adlm-helper/dlm/expr"
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Object in the bucket holding the custom rules
+const RulesKey = file.RulesName
+
+// Rule severity levels
+const (
+	SeverityError = "error"
+	SeverityWarn  = "warn"
+)
+
+// Custom rule written as expressions over the policy
+// and the S3 object. See package expr for the syntax.
+type Rule struct {
+	Name        string `yaml:"Name"`
+	Description string `yaml:"Description,omitempty"`
+
+	// error fails the upload, warn only logs. Defaults to error
+	Severity string `yaml:"Severity,omitempty"`
+
+	// Optional condition for the rule to apply
+	When string `yaml:"When,omitempty"`
+
+	// Condition the policy must satisfy
+	Expression string `yaml:"Expression"`
+
+	// Shown when the rule fails
+	Message string `yaml:"Message,omitempty"`
+
+	when       *expr.Expr
+	expression *expr.Expr
+}
+
+// Custom rules file
+type RuleSet struct {
+	Rules []*Rule `yaml:"Rules"`
+}
+
+// Outcome of a rule
+type RuleResult struct {
+	Rule     string
+	Severity string
+	Passed   bool
+	Skipped  bool
+	Message  string
+}
+
+// Error returned when a policy fails error level rules
+type RuleError struct {
+	Key    string
+	Failed []RuleResult
+}
+
+func (e *RuleError) Error() string {
+	var msgs []string
+	for _, r := range e.Failed {
+		msgs = append(msgs, fmt.Sprintf("rule %s: %s", r.Rule, r.Message))
+	}
+
+	return fmt.Sprintf("Policy %s fails %s", e.Key, strings.Join(msgs, "; "))
+}
+
+// Load custom rules from the bucket.
+// It returns nil if the bucket has no rules.
+func LoadRules(bucket string, downloader s3manageriface.DownloaderAPI) (*RuleSet, error) {
+	raw, err := file.Download(bucket, RulesKey, downloader)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("Failed to load rules from %s/%s: %v", bucket, RulesKey, err)
+	}
+
+	return ParseRules(raw)
+}
+
+// Parse and compile custom rules
+func ParseRules(raw []byte) (*RuleSet, error) {
+	rs := new(RuleSet)
+	if err := yaml.UnmarshalStrict(raw, rs); err != nil {
+		return nil, fmt.Errorf("Failed to parse rules: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, r := range rs.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("Failed to parse rules: every rule must have a name")
+		}
+
+		if names[r.Name] {
+			return nil, fmt.Errorf("Failed to parse rules: duplicated rule %s", r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityError
+		case SeverityError, SeverityWarn:
+		default:
+			return nil, fmt.Errorf("Failed to parse rule %s: unknown severity %q", r.Name, r.Severity)
+		}
+
+		var err error
+		if r.expression, err = expr.Compile(r.Expression); err != nil {
+			return nil, fmt.Errorf("Failed to parse rule %s: %v", r.Name, err)
+		}
+
+		if r.When != "" {
+			if r.when, err = expr.Compile(r.When); err != nil {
+				return nil, fmt.Errorf("Failed to parse rule %s: %v", r.Name, err)
+			}
+		}
+	}
+
+	return rs, nil
+}
+
+// Variables exposed to the rule expressions:
+// policy is the policy file as written in yaml and
+// object describes the S3 object it comes from.
+func ruleVars(p *file.Policy, obj events.S3Object, bucket string) (map[string]interface{}, error) {
+	raw, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err = yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"policy": expr.Normalize(doc),
+		"object": expr.Normalize(map[string]interface{}{
+			"Bucket":    bucket,
+			"Key":       obj.Key,
+			"Dir":       path.Dir(obj.Key),
+			"Name":      path.Base(obj.Key),
+			"Size":      obj.Size,
+			"ETag":      obj.ETag,
+			"VersionId": obj.VersionID,
+		}),
+	}, nil
+}
+
+// Evaluate every rule. A rule whose expression can't
+// be evaluated fails with the evaluation error.
+func (rs *RuleSet) Evaluate(p *file.Policy, obj events.S3Object, bucket string) ([]RuleResult, error) {
+	vars, err := ruleVars(p, obj, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RuleResult
+	for _, r := range rs.Rules {
+		res := RuleResult{Rule: r.Name, Severity: r.Severity}
+
+		if r.when != nil {
+			applies, err := r.when.EvalBool(vars)
+			if err != nil {
+				res.Message = err.Error()
+				results = append(results, res)
+				continue
+			}
+
+			if !applies {
+				res.Passed, res.Skipped = true, true
+				results = append(results, res)
+				continue
+			}
+		}
+
+		passed, err := r.expression.EvalBool(vars)
+		switch {
+		case err != nil:
+			res.Message = err.Error()
+		case !passed:
+			res.Message = r.Message
+			if res.Message == "" {
+				res.Message = fmt.Sprintf("%s is false", r.Expression)
+			}
+		default:
+			res.Passed = true
+		}
+
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// Check policy against the configured custom rules or
+// those stored in the bucket, logging every result
+func (u Upserter) checkRules(f *file.Policy) error {
+	rs, err := u.rules()
+	if err != nil || rs == nil {
+		return err
+	}
+
+	results, err := rs.Evaluate(f, u.item.record.S3.Object, u.item.record.S3.Bucket.Name)
+	if err != nil {
+		return err
+	}
+
+	key := u.item.record.S3.Object.Key
+	var failed []RuleResult
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			log.Println(fmt.Sprintf("%s Rule %s skipped for %s", msgPrefix, r.Rule, key))
+		case r.Passed:
+			log.Println(fmt.Sprintf("%s Rule %s passed for %s", msgPrefix, r.Rule, key))
+		case r.Severity == SeverityWarn:
+			log.Println(fmt.Sprintf("%s Rule %s failed for %s: %s", warnPrefix, r.Rule, key, r.Message))
+		default:
+			log.Println(fmt.Sprintf("%s Rule %s failed for %s: %s", errorPrefix, r.Rule, key, r.Message))
+			failed = append(failed, r)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &RuleError{Key: key, Failed: failed}
+	}
+
+	return nil
+}
+
+// Configured rules, or those of the event's bucket
+func (u Upserter) rules() (*RuleSet, error) {
+	if u.config != nil && u.config.Rules != nil {
+		return u.config.Rules, nil
+	}
+
+	bucket := u.item.record.S3.Bucket.Name
+	if bucket == "" {
+		return nil, nil
+	}
+
+	return LoadRules(bucket, u.client.S3Downloader)
+}
@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+const rules = `
+Rules:
+- Name: prod-twice-daily
+  Description: Production policies must run at least twice a day
+  When: object.Key.startsWith("prod/")
+  Expression: policy.PolicyDetails.Schedules.all(s, s.CreateRule.Interval <= 12)
+  Message: production policies must run at least twice a day
+- Name: described
+  Severity: warn
+  Expression: has(policy.Description)
+- Name: enabled
+  Expression: policy.State == "ENABLED"
+`
+
+func TestParseRulesError(t *testing.T) {
+	for _, raw := range []string{
+		"Rules:\n- Expression: true",
+		"Rules:\n- Name: a\n  Expression: true\n- Name: a\n  Expression: true",
+		"Rules:\n- Name: a\n  Severity: fatal\n  Expression: true",
+		"Rules:\n- Name: a\n  Expression: (true",
+		"Rulez: []",
+	} {
+		_, err := ParseRules([]byte(raw))
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestRuleSetEvaluate(t *testing.T) {
+	rs, err := ParseRules([]byte(rules))
+	assert.NoError(t, err)
+
+	upserter := GetUpserterProcessor(false).(Upserter)
+	f, err := upserter.load()
+	assert.NoError(t, err)
+
+	results, err := rs.Evaluate(f, events.S3Object{Key: "prod/app.yaml"}, "dummy-bucket")
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	assert.Equal(t, "prod-twice-daily", results[0].Rule)
+	assert.False(t, results[0].Passed)
+	assert.Equal(t, "production policies must run at least twice a day", results[0].Message)
+	assert.True(t, results[1].Passed)
+	assert.True(t, results[2].Passed)
+
+	results, err = rs.Evaluate(f, events.S3Object{Key: "dev/app.yaml"}, "dummy-bucket")
+	assert.NoError(t, err)
+	assert.True(t, results[0].Skipped)
+}
+
+func TestCreatePolicyRuleFailure(t *testing.T) {
+	record.EventName = "ObjectCreated:Put"
+
+	p := new(Policy)
+	p.SetClients(&AwsClients{
+		S3Downloader: &test.MockDownloader{
+			Objects: map[string]string{
+				RulesKey: "Rules:\n- Name: disabled\n  Expression: policy.State == \"DISABLED\"\n- Name: soft\n  Severity: warn\n  Expression: false",
+			},
+		},
+		Dynamodb: new(test.MockDynamoDB),
+		Dlm:      new(test.MockDlm),
+	})
+	p.SetPolicy(record, context)
+
+	err := p.Dispatch().(Upserter).CreatePolicy()
+	if assert.IsType(t, &RuleError{}, err) {
+		assert.Len(t, err.(*RuleError).Failed, 1)
+		assert.Contains(t, err.Error(), "disabled")
+	}
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Policy file and the S3 key it is stored under
+type Source struct {
+	Key    string
+	Policy *file.Policy
+
+	// Version the policy is pinned to by a rollback, if any
+	RollbackVersion string
+
+	// Why the object isn't a valid policy file. The
+	// policy is nil then.
+	Err error
+}
+
+// Load the policy files of a local directory.
+// Keys are the paths relative to the directory
+// under the given prefix, as if the directory had
+// been uploaded to the bucket prefix.
+func LoadLocalSources(dir, prefix string) ([]*Source, error) {
+	files, err := file.Find(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []*Source
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := file.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %v", f, err)
+		}
+
+		sources = append(sources, &Source{
+			Key:    path.Join(prefix, filepath.ToSlash(rel)),
+			Policy: p,
+		})
+	}
+
+	return sources, nil
+}
+
+// Load the policy objects of a bucket prefix.
+// Like the handler, every object that is neither a
+// directory nor reserved is a policy. Objects that
+// can't be parsed are returned with the error, so
+// one stray object doesn't stop the others.
+func LoadBucketSources(bucket, prefix string, client s3iface.S3API, downloader s3manageriface.DownloaderAPI) ([]*Source, error) {
+	var keys []string
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			k := aws.StringValue(o.Key)
+			if !strings.HasSuffix(k, "/") && !file.IsReserved(k) {
+				keys = append(keys, k)
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []*Source
+	for _, k := range keys {
+		raw, err := file.Download(bucket, k, downloader)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := file.Parse(raw)
+		if err != nil {
+			sources = append(sources, &Source{Key: k, Err: fmt.Errorf("Failed to parse s3://%s/%s: %v", bucket, k, err)})
+			continue
+		}
+
+		sources = append(sources, &Source{Key: k, Policy: p})
+	}
+
+	return sources, nil
+}
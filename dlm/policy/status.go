@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+)
+
+// State of a policy that no longer exists in DLM
+const StateMissing = "MISSING"
+
+// Registry record joined with the live DLM state
+type PolicyStatus struct {
+	Key           string `json:"key"`
+	PolicyId      string `json:"policyId"`
+	ObjectVersion string `json:"objectVersion,omitempty"`
+	State         string `json:"state"`
+	StatusMessage string `json:"statusMessage,omitempty"`
+	LastModified  string `json:"lastModified,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+	RequestId     string `json:"requestId"`
+}
+
+// Status lists the managed policies with their live
+// state. Records whose policy no longer exists get
+// the MISSING state, pending creates the PENDING state.
+func (p *Policy) Status() ([]*PolicyStatus, error) {
+	items, err := p.dbconn.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []*PolicyStatus
+	for _, i := range items {
+		s := &PolicyStatus{
+			Key:           i.S3ObjectKey,
+			PolicyId:      i.PolicyId,
+			ObjectVersion: i.ObjectVersion,
+			State:         StateMissing,
+			CreatedAt:     i.CreatedAt,
+			UpdatedAt:     i.UpdatedAt,
+			RequestId:     i.RequestId,
+		}
+
+		lp, err := p.getLivePolicy(i.PolicyId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get policy %s of %s: %v", i.PolicyId, i.S3ObjectKey, err)
+		}
+
+		if lp != nil {
+			s.State = aws.StringValue(lp.State)
+			s.StatusMessage = aws.StringValue(lp.StatusMessage)
+			if lp.DateModified != nil {
+				s.LastModified = lp.DateModified.UTC().Format(time.RFC3339)
+			}
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	// Creates in progress or failed have no policy to show yet
+	pending, err := p.dbconn.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range pending {
+		statuses = append(statuses, &PolicyStatus{
+			Key:       i.S3ObjectKey,
+			PolicyId:  i.PolicyId,
+			State:     db.StatePending,
+			CreatedAt: i.CreatedAt,
+			UpdatedAt: i.PendingSince,
+			RequestId: i.RequestId,
+		})
+	}
+
+	sort.SliceStable(statuses, func(a, b int) bool {
+		return statuses[a].Key < statuses[b].Key
+	})
+
+	return statuses, nil
+}
+
+// Print the statuses as a table
+func WriteStatus(w io.Writer, statuses []*PolicyStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tPOLICY ID\tVERSION\tSTATE\tLAST MODIFIED\tCREATED\tUPDATED\tREQUEST ID\tMESSAGE")
+
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Key, dash(s.PolicyId), dash(s.ObjectVersion), s.State, dash(s.LastModified), dash(s.CreatedAt),
+			dash(s.UpdatedAt), dash(s.RequestId), dash(s.StatusMessage))
+	}
+
+	return tw.Flush()
+}
+
+// Placeholder of empty columns
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
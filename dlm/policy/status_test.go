@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/db"
+	"github.com/liangrog/adlm-helper/dlm/test"
+)
+
+func TestStatus(t *testing.T) {
+	p := new(Policy)
+	p.SetClients(&AwsClients{Dlm: &test.MockDlm{Payload: map[string]string{"state": "ERROR", "message": "Role is missing"}}})
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "a.yaml", PolicyId: "a-id", RequestId: "r-1", CreatedAt: "c", UpdatedAt: "u", ObjectVersion: "v1"}))
+
+	statuses, err := p.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, []*PolicyStatus{{
+		Key:           "a.yaml",
+		PolicyId:      "a-id",
+		ObjectVersion: "v1",
+		State:         "ERROR",
+		StatusMessage: "Role is missing",
+		LastModified:  "2019-01-02T03:04:05Z",
+		CreatedAt:     "c",
+		UpdatedAt:     "u",
+		RequestId:     "r-1",
+	}}, statuses)
+}
+
+func TestStatusMissing(t *testing.T) {
+	p := new(Policy)
+	p.SetClients(&AwsClients{Dlm: &test.MockDlm{Payload: map[string]string{"missing": "yes"}}})
+	p.SetDBConn(db.NewMemory(&db.Item{S3ObjectKey: "a.yaml", PolicyId: "a-id"}))
+
+	statuses, err := p.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, StateMissing, statuses[0].State)
+}
+
+func TestStatusPending(t *testing.T) {
+	p := new(Policy)
+	p.SetClients(&AwsClients{Dlm: new(test.MockDlm)})
+	p.SetDBConn(db.NewMemory(
+		&db.Item{S3ObjectKey: "b.yaml", PolicyId: "b-id"},
+		&db.Item{S3ObjectKey: "a.yaml", State: db.StatePending, ClientToken: "token", PendingSince: "2019-11-01T00:00:00Z"},
+	))
+
+	statuses, err := p.Status()
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, &PolicyStatus{Key: "a.yaml", State: db.StatePending, UpdatedAt: "2019-11-01T00:00:00Z"}, statuses[0])
+}
+
+func TestWriteStatus(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, WriteStatus(&b, []*PolicyStatus{{Key: "a.yaml", PolicyId: "a-id", State: StateMissing}}))
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "KEY"))
+	assert.Equal(t, []string{"a.yaml", "a-id", "-", "MISSING", "-", "-", "-", "-", "-"}, strings.Fields(lines[1]))
+}
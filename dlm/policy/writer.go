@@ -0,0 +1,44 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+
+	"github.com/liangrog/adlm-helper/dlm/file"
+)
+
+// Destination of policy files by S3 key
+type Writer interface {
+	Write(key string, raw []byte) error
+}
+
+// Writes policy files into a local directory.
+// The prefix is stripped from the keys, the
+// reverse of LoadLocalSources.
+type DirWriter struct {
+	Dir    string
+	Prefix string
+}
+
+func (w DirWriter) Write(key string, raw []byte) error {
+	name := filepath.Join(w.Dir, filepath.FromSlash(strings.TrimPrefix(key, w.Prefix)))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(name, raw, 0644)
+}
+
+// Uploads policy files to a bucket
+type BucketWriter struct {
+	Bucket   string
+	Uploader s3manageriface.UploaderAPI
+}
+
+func (w BucketWriter) Write(key string, raw []byte) error {
+	return file.Upload(w.Bucket, key, raw, w.Uploader)
+}
@@ -1,7 +1,12 @@
 package test
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
@@ -30,6 +35,10 @@ func (m MockDynamoDB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput,
 			},
 		}
 
+		if s := m.Payload["sequencer"]; s != "" {
+			item["sequencer"] = &dynamodb.AttributeValue{S: aws.String(s)}
+		}
+
 		output = &dynamodb.QueryOutput{
 			Items: []map[string]*dynamodb.AttributeValue{
 				item,
@@ -42,25 +51,82 @@ func (m MockDynamoDB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput,
 	return output, nil
 }
 
-func (m MockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+func (m MockDynamoDB) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
 
+	// Test listing other records condition
+	output := &dynamodb.ScanOutput{}
+	if m.Payload["scan"] == "yes" {
+		output.Items = []map[string]*dynamodb.AttributeValue{
+			{
+				"S3ObjectKey": {
+					S: aws.String("other.yaml"),
+				},
+				"PolicyId": {
+					S: aws.String("other-id"),
+				},
+			},
+		}
+	}
+
+	return output, nil
+}
+
+// Writes fail their condition if Payload["condition"] is "failed"
+func (m MockDynamoDB) conditionErr() error {
+	if m.Payload["condition"] == "failed" {
+		return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+
+	return m.Err
+}
+
+func (m MockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if err := m.conditionErr(); err != nil {
+		return nil, err
+	}
+
 	return &dynamodb.PutItemOutput{}, nil
 }
 
+// Like DynamoDB, expressions must use every value given
+// and no other
+func checkValues(values map[string]*dynamodb.AttributeValue, expressions ...string) error {
+	used := make(map[string]bool)
+	for _, v := range regexp.MustCompile(`:[A-Za-z0-9_]+`).FindAllString(strings.Join(expressions, " "), -1) {
+		if values[v] == nil {
+			return awserr.New("ValidationException", fmt.Sprintf("Value %s is used but not defined", v), nil)
+		}
+
+		used[v] = true
+	}
+
+	for v := range values {
+		if !used[v] {
+			return awserr.New("ValidationException", fmt.Sprintf("Value %s is defined but not used", v), nil)
+		}
+	}
+
+	return nil
+}
+
 func (m MockDynamoDB) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
-	if m.Err != nil {
-		return nil, m.Err
+	if err := m.conditionErr(); err != nil {
+		return nil, err
+	}
+
+	if err := checkValues(input.ExpressionAttributeValues, aws.StringValue(input.UpdateExpression), aws.StringValue(input.ConditionExpression)); err != nil {
+		return nil, err
 	}
 
 	return &dynamodb.UpdateItemOutput{}, nil
 }
 
 func (m MockDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
-	if m.Err != nil {
-		return nil, m.Err
+	if err := m.conditionErr(); err != nil {
+		return nil, err
 	}
 
 	return &dynamodb.DeleteItemOutput{}, nil
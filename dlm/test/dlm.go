@@ -1,7 +1,11 @@
 package test
 
 import (
+	"strings"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dlm"
 	"github.com/aws/aws-sdk-go/service/dlm/dlmiface"
 )
@@ -33,5 +37,92 @@ func (d *MockDlm) UpdateLifecyclePolicy(i *dlm.UpdateLifecyclePolicyInput) (*dlm
 		return nil, d.Err
 	}
 
+	if d.Payload["missing"] == "yes" {
+		return nil, awserr.New(dlm.ErrCodeResourceNotFoundException, "Policy not found", nil)
+	}
+
 	return nil, nil
 }
+
+func (d *MockDlm) GetLifecyclePolicies(i *dlm.GetLifecyclePoliciesInput) (*dlm.GetLifecyclePoliciesOutput, error) {
+	if d.Err != nil {
+		return nil, d.Err
+	}
+
+	// Policy ids to return are given as comma separated list
+	output := &dlm.GetLifecyclePoliciesOutput{}
+	if ids := d.Payload["policies"]; ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			output.Policies = append(output.Policies, &dlm.LifecyclePolicySummary{
+				PolicyId: aws.String(id),
+				State:    aws.String(dlm.GettablePolicyStateValuesEnabled),
+			})
+		}
+	}
+
+	return output, nil
+}
+
+// Live policy matching testdata/policy_example.yaml
+func (d *MockDlm) GetLifecyclePolicy(i *dlm.GetLifecyclePolicyInput) (*dlm.GetLifecyclePolicyOutput, error) {
+	if d.Err != nil {
+		return nil, d.Err
+	}
+
+	if d.Payload["missing"] == "yes" {
+		return nil, awserr.New(dlm.ErrCodeResourceNotFoundException, "Policy not found", nil)
+	}
+
+	state := dlm.GettablePolicyStateValuesEnabled
+	if s := d.Payload["state"]; s != "" {
+		state = s
+	}
+
+	// Provenance tags of the given key
+	var tags map[string]*string
+	if k := d.Payload["managed"]; k != "" {
+		tags = map[string]*string{
+			"adlm-helper:managed": aws.String("true"),
+			"adlm-helper:key":     aws.String(k),
+		}
+	}
+
+	output := &dlm.GetLifecyclePolicyOutput{
+		Policy: &dlm.LifecyclePolicy{
+			Tags:             tags,
+			DateModified:     aws.Time(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)),
+			StatusMessage:    aws.String(d.Payload["message"]),
+			Description:      aws.String("My Awesome Data Lifecycl Management Daily Snapshot"),
+			ExecutionRoleArn: aws.String("arn:aws:iam::123456789101:role/AWSDataLifecycleManagerDefaultRole"),
+			PolicyId:         i.PolicyId,
+			State:            aws.String(state),
+			PolicyDetails: &dlm.PolicyDetails{
+				ResourceTypes: []*string{aws.String("VOLUME")},
+				TargetTags: []*dlm.Tag{
+					{Key: aws.String("Name"), Value: aws.String("Aweful Stateful Application")},
+				},
+				Schedules: []*dlm.Schedule{
+					{
+						Name: aws.String("DailySnapshots"),
+						CreateRule: &dlm.CreateRule{
+							Interval:     aws.Int64(24),
+							IntervalUnit: aws.String("HOURS"),
+							Times:        []*string{aws.String("01:00")},
+						},
+						RetainRule: &dlm.RetainRule{Count: aws.Int64(7)},
+						TagsToAdd: []*dlm.Tag{
+							{Key: aws.String("SnapName"), Value: aws.String("Awesome Snapshot")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// Scheduled by a cron expression instead
+	if id := d.Payload["cron"]; id != "" && id == aws.StringValue(i.PolicyId) {
+		output.Policy.PolicyDetails.Schedules[0].CreateRule.SetCronExpression("cron(0 1 ? * MON *)")
+	}
+
+	return output, nil
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// Trust policy letting DLM assume the role
+const DlmTrustPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"dlm.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+
+// Mocking IAM. By default the role exists,
+// trusts DLM and is allowed every action.
+type MockIam struct {
+	iamiface.IAMAPI
+	Payload map[string]string // Store expected return values
+	Err     error
+}
+
+func (m *MockIam) GetRole(i *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	if m.Payload["missing"] == "yes" {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "The role cannot be found.", nil)
+	}
+
+	trust := DlmTrustPolicy
+	if t, ok := m.Payload["trust"]; ok {
+		trust = t
+	}
+
+	return &iam.GetRoleOutput{
+		Role: &iam.Role{
+			Arn:                      aws.String("arn:aws:iam::123456789101:role/" + aws.StringValue(i.RoleName)),
+			RoleName:                 i.RoleName,
+			AssumeRolePolicyDocument: aws.String(url.QueryEscape(trust)),
+		},
+	}, nil
+}
+
+func (m *MockIam) SimulatePrincipalPolicy(i *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	// Denied actions are given as comma separated list
+	denied := strings.Split(m.Payload["denied"], ",")
+
+	// Actions only allowed on a resource are given as
+	// comma separated action=resource pairs
+	scoped := make(map[string]string)
+	for _, s := range strings.Split(m.Payload["scoped"], ",") {
+		if kv := strings.SplitN(s, "=", 2); len(kv) == 2 {
+			scoped[kv[0]] = kv[1]
+		}
+	}
+
+	output := &iam.SimulatePolicyResponse{}
+	for _, a := range i.ActionNames {
+		decision := iam.PolicyEvaluationDecisionTypeAllowed
+		for _, d := range denied {
+			if d == aws.StringValue(a) {
+				decision = iam.PolicyEvaluationDecisionTypeImplicitDeny
+			}
+		}
+
+		if r, ok := scoped[aws.StringValue(a)]; ok {
+			for _, arn := range i.ResourceArns {
+				if aws.StringValue(arn) != r {
+					decision = iam.PolicyEvaluationDecisionTypeImplicitDeny
+				}
+			}
+
+			if len(i.ResourceArns) == 0 {
+				decision = iam.PolicyEvaluationDecisionTypeImplicitDeny
+			}
+		}
+
+		output.EvaluationResults = append(output.EvaluationResults, &iam.EvaluationResult{
+			EvalActionName: a,
+			EvalDecision:   aws.String(decision),
+		})
+	}
+
+	return output, nil
+}
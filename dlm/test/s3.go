@@ -6,8 +6,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 )
@@ -30,10 +35,102 @@ var (
 // Mocking Downloader
 type MockDownloader struct {
 	s3manageriface.DownloaderAPI
+	Objects map[string]string // Object content by key or key?versionId=id. Other keys get the policy example
 }
 
 func (md *MockDownloader) Download(iw io.WriterAt, gi *s3.GetObjectInput, dl ...func(*s3manager.Downloader)) (int64, error) {
-	return CopyFile(SrcTestFile, DestTestFile)
+	key := aws.StringValue(gi.Key)
+	if v := aws.StringValue(gi.VersionId); v != "" {
+		key = fmt.Sprintf("%s?versionId=%s", key, v)
+	}
+
+	var raw []byte
+	if c, ok := md.Objects[key]; ok {
+		raw = []byte(c)
+	} else if strings.HasPrefix(path.Base(key), "_") {
+		// Reserved objects don't exist unless given
+		return 0, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	} else {
+		var err error
+		if raw, err = ioutil.ReadFile(SrcTestFile); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := iw.WriteAt(raw, 0)
+	return int64(n), err
+}
+
+// Mocking S3
+type MockS3 struct {
+	s3iface.S3API
+	Payload map[string]string // Store expected return values
+	Err     error
+}
+
+// Lists the comma separated keys of Payload["objects"]
+func (m *MockS3) ListObjectsV2Pages(i *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	output := &s3.ListObjectsV2Output{}
+	if keys := m.Payload["objects"]; keys != "" {
+		for _, k := range strings.Split(keys, ",") {
+			if strings.HasPrefix(k, aws.StringValue(i.Prefix)) {
+				output.Contents = append(output.Contents, &s3.Object{Key: aws.String(k)})
+			}
+		}
+	}
+
+	fn(output, true)
+
+	return nil
+}
+
+// Lists the comma separated version ids of Payload["versions"],
+// newest first, for the prefix. A "deleted" id is a delete marker.
+func (m *MockS3) ListObjectVersionsPages(i *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	output := &s3.ListObjectVersionsOutput{}
+	if ids := m.Payload["versions"]; ids != "" {
+		modified := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+		for n, id := range strings.Split(ids, ",") {
+			latest := n == 0
+			at := modified.Add(-time.Duration(n) * time.Hour)
+
+			if id == "deleted" {
+				output.DeleteMarkers = append(output.DeleteMarkers, &s3.DeleteMarkerEntry{
+					IsLatest:     aws.Bool(latest),
+					Key:          i.Prefix,
+					LastModified: &at,
+					VersionId:    aws.String(id),
+				})
+				continue
+			}
+
+			output.Versions = append(output.Versions, &s3.ObjectVersion{
+				IsLatest:     aws.Bool(latest),
+				Key:          i.Prefix,
+				LastModified: &at,
+				Size:         aws.Int64(100),
+				VersionId:    aws.String(id),
+			})
+		}
+
+		// Other keys sharing the prefix
+		output.Versions = append(output.Versions, &s3.ObjectVersion{
+			Key:       aws.String(aws.StringValue(i.Prefix) + ".bak"),
+			VersionId: aws.String("other"),
+		})
+	}
+
+	fn(output, true)
+
+	return nil
 }
 
 // Copy files locally
@@ -60,3 +157,28 @@ func CopyFile(src, dest string) (int64, error) {
 func DeleteFile(src string) error {
 	return os.Remove(src)
 }
+
+// Mocking Uploader
+type MockUploader struct {
+	s3manageriface.UploaderAPI
+	Objects map[string]string // Uploaded content by key
+	Err     error
+}
+
+func (mu *MockUploader) Upload(ui *s3manager.UploadInput, ul ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	if mu.Err != nil {
+		return nil, mu.Err
+	}
+
+	raw, err := ioutil.ReadAll(ui.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if mu.Objects == nil {
+		mu.Objects = make(map[string]string)
+	}
+	mu.Objects[aws.StringValue(ui.Key)] = string(raw)
+
+	return &s3manager.UploadOutput{}, nil
+}
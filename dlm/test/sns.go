@@ -0,0 +1,24 @@
+package test
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+)
+
+// Mocking SNS
+type MockSns struct {
+	snsiface.SNSAPI
+	Messages []string // Published messages
+	Err      error
+}
+
+func (m *MockSns) Publish(i *sns.PublishInput) (*sns.PublishOutput, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	m.Messages = append(m.Messages, aws.StringValue(i.Message))
+
+	return &sns.PublishOutput{MessageId: aws.String("message-id")}, nil
+}
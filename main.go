@@ -2,76 +2,88 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/lambdacontext"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dlm"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sns"
 
 	"github.com/liangrog/adlm-helper/dlm/policy"
 )
 
 const (
 	msgPrefix = "[ADLM-HELPER-INFO]"
+
+	// Detail type of the events of schedule rules
+	scheduledEvent = "Scheduled Event"
 )
 
 func main() {
 	lambda.Start(handler)
 }
 
-func handler(ctx context.Context, s3Event events.S3Event) error {
-	// Convert context
-	lc, ok := lambdacontext.FromContext(ctx)
-	if !ok {
-		log.Println("Failed to convert context to lambdacontext")
-	}
-
-	p := new(policy.Policy)
-
+// Handles S3 events and scheduled events. A scheduled
+// event reconciles the whole bucket.
+func handler(ctx context.Context, raw json.RawMessage) error {
 	// Initiate aws client
 	sess := session.Must(session.NewSession())
 	clients := &policy.AwsClients{
+		S3:           s3.New(sess),
 		S3Downloader: s3manager.NewDownloader(sess),
 		Dynamodb:     dynamodb.New(sess),
 		Dlm:          dlm.New(sess),
+		Iam:          iam.New(sess),
+		Sns:          sns.New(sess),
+	}
+
+	return handle(ctx, raw, clients)
+}
+
+// Process the event with the given clients
+func handle(ctx context.Context, raw json.RawMessage, clients *policy.AwsClients) error {
+	// Convert context
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		log.Println("Failed to convert context to lambdacontext")
+		lc = new(lambdacontext.LambdaContext)
 	}
 
+	p := new(policy.Policy)
 	p.SetClients(clients)
 
-	errCount := 0
-	for _, record := range s3Event.Records {
-		// Ignore if event triggered is by directory lifecycle
-		if isDir(record.S3.Object.Key) {
-			log.Println(fmt.Sprintf("%s Ignoring event triggered by %s because it is not a file", msgPrefix, record.S3.Object.Key))
-			continue
-		}
+	config, err := policy.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
 
-		p.SetPolicy(record, *lc)
-		err := p.Dispatch().Execute()
-		if err != nil {
-			// Log event for debugging
-			log.Println(fmt.Sprintf("%s %v", msgPrefix, record))
+	p.SetConfig(config)
 
-			errCount++
+	scheduled := new(events.CloudWatchEvent)
+	if err := json.Unmarshal(raw, scheduled); err == nil && scheduled.DetailType == scheduledEvent {
+		log.Println(fmt.Sprintf("%s Reconciling bucket %s", msgPrefix, config.Bucket))
+		_, err := p.Reconcile(config.Bucket, config.MaxChanges, *lc)
+		return err
+	}
 
-			// Logging event for debugging
-			log.Println(fmt.Sprintf("%s %v", msgPrefix, record))
+	s3Event := new(events.S3Event)
+	if err := json.Unmarshal(raw, s3Event); err != nil {
+		return fmt.Errorf("%s Failed to parse event: %v", msgPrefix, err)
+	}
 
-			if awsErr, ok := err.(awserr.Error); ok {
-				log.Println("Error:", awsErr.Error())
-			} else {
-				log.Println(err)
-			}
-		} else {
-			log.Println(fmt.Sprintf("%s Successfully processed event triggered by %s", msgPrefix, record.S3.Object.Key))
+	errCount := 0
+	for _, r := range p.HandleRecords(s3Event.Records, *lc) {
+		if !r.Ok() {
+			errCount++
 		}
 	}
 
@@ -81,8 +93,3 @@ func handler(ctx context.Context, s3Event events.S3Event) error {
 
 	return nil
 }
-
-// If it's a S3 directory
-func isDir(s string) bool {
-	return strings.HasSuffix(s, "/")
-}
@@ -1,15 +1,65 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"os"
 	"testing"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/liangrog/adlm-helper/dlm/local"
+	"github.com/liangrog/adlm-helper/dlm/policy"
+	"github.com/liangrog/adlm-helper/dlm/test"
 )
 
-func TestIsDir(t *testing.T) {
-	isD := "testing/"
-	assert.True(t, isDir(isD))
+func TestHandle(t *testing.T) {
+	event, err := json.Marshal(events.S3Event{
+		Records: []events.S3EventRecord{
+			{
+				EventName: "ObjectCreated:Put",
+				S3: events.S3Entity{
+					Object: events.S3Object{Key: test.PolicyExampleFileName},
+				},
+			},
+			{
+				EventName: "ObjectCreated:Put",
+				S3: events.S3Entity{
+					Object: events.S3Object{Key: "policies/"},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	clients := &policy.AwsClients{
+		S3Downloader: local.Downloader{Dir: "testdata"},
+		Dynamodb:     new(test.MockDynamoDB),
+		Dlm:          new(test.MockDlm),
+	}
+
+	assert.NoError(t, handle(context.Background(), event, clients))
+
+	clients.Dlm = &test.MockDlm{Err: assert.AnError}
+	assert.Error(t, handle(context.Background(), event, clients))
+}
+
+func TestHandleScheduled(t *testing.T) {
+	event := []byte(`{"detail-type": "Scheduled Event", "source": "aws.events", "detail": {}}`)
+
+	clients := &policy.AwsClients{
+		S3:           &test.MockS3{Payload: map[string]string{"objects": test.PolicyExampleFileName}},
+		S3Downloader: local.Downloader{Dir: "testdata"},
+		Dynamodb:     new(test.MockDynamoDB),
+		Dlm:          new(test.MockDlm),
+	}
+
+	// The bucket must be configured
+	assert.Error(t, handle(context.Background(), event, clients))
+
+	os.Setenv(policy.EnvBucket, "dummy-bucket")
+	defer os.Unsetenv(policy.EnvBucket)
 
-	notD := "testing"
-	assert.False(t, isDir(notD))
+	assert.NoError(t, handle(context.Background(), event, clients))
 }